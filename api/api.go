@@ -1,5 +1,7 @@
 package api
 
+import "time"
+
 //go:generate mockgen -destination mock_api/api.go github.com/andig/evcc/api Charger,ChargeController,Meter
 
 // Meter is able to provide current power at metering point
@@ -38,14 +40,62 @@ type ChargeController interface {
 	MaxCurrent(current int64) error
 }
 
+// CurrentLimiter provides the charger's supported current range
+type CurrentLimiter interface {
+	CurrentLimits() (min int64, max int64)
+}
+
+// Heartbeat is implemented by chargers with a failsafe that must be refreshed
+// regularly while evcc is controlling the charger
+type Heartbeat interface {
+	Heartbeat() error
+}
+
+// Vehicle represents the car connected to a loadpoint
+type Vehicle interface {
+	Title() string
+	Capacity() int64
+}
+
+// ChargeState provides the vehicle's state of charge in %
+type ChargeState interface {
+	ChargeState() (float64, error)
+}
+
+// Rate is the value of a time slot, e.g. price or CO2 intensity per kWh or
+// forecast power
+type Rate struct {
+	Start time.Time
+	End   time.Time
+	Value float64
+}
+
+// Tariff provides energy prices for current and upcoming time slots
+type Tariff interface {
+	Rates() ([]Rate, error)
+}
+
+// Intensity provides grid CO2 intensity in g/kWh for current and upcoming time slots
+type Intensity interface {
+	Rates() ([]Rate, error)
+}
+
+// Forecast provides pv production forecast in W for current and upcoming time slots
+type Forecast interface {
+	Rates() ([]Rate, error)
+}
+
 // ChargeMode are charge modes modeled after OpenWB
 type ChargeMode string
 
 const (
-	ModeOff   ChargeMode = "off"
-	ModeNow   ChargeMode = "now"
-	ModeMinPV ChargeMode = "minpv"
-	ModePV    ChargeMode = "pv"
+	ModeOff         ChargeMode = "off"
+	ModeNow         ChargeMode = "now"
+	ModeMinPV       ChargeMode = "minpv"
+	ModePV          ChargeMode = "pv"
+	ModeCheap       ChargeMode = "cheap"
+	ModeClean       ChargeMode = "clean"
+	ModeFeedInLimit ChargeMode = "feedinlimit"
 )
 
 // LoadPoint ties charger and meter together and contains the controller logic
@@ -53,4 +103,8 @@ type LoadPoint interface {
 	Update()
 	CurrentChargeMode() ChargeMode
 	ChargeMode(mode ChargeMode) error
+	SetMinCurrent(current int64) error
+	SetMaxCurrent(current int64) error
+	SetPhases(phases int64) error
+	SetTargetSoC(soc int64) error
 }
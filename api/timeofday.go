@@ -0,0 +1,16 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ParseTimeOfDay parses hh:mm into duration since midnight
+func ParseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day '%s'", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -1,9 +1,50 @@
-// use for testing purposes
-const baseurl = {
-  protocol: "http:",
-  hostname: "localhost",
-  port: "7070",
-};
+// use for testing purposes, e.g. { protocol: "http:", hostname: "localhost", port: "7070" }
+const baseurl = null;
+
+const login = new Vue({
+  el: '#login',
+  data: {
+    visible: false,
+    name: "",
+    password: "",
+    error: null,
+  },
+  methods: {
+    login: function () {
+      const self = this;
+      axios.post('auth/login', { name: this.name, password: this.password }).then(function (response) {
+        self.visible = false;
+        self.password = "";
+        self.error = null;
+        auth.update(response.data);
+        mode.refresh();
+      }).catch(function (error) {
+        self.error = "Anmeldung fehlgeschlagen";
+      });
+    },
+  },
+});
+
+const auth = new Vue({
+  el: '#auth',
+  data: {
+    enabled: false,
+    role: "",
+  },
+  methods: {
+    update: function (data) {
+      this.enabled = data.enabled;
+      this.role = data.role;
+      login.visible = this.enabled && !this.role;
+    },
+    logout: function () {
+      const self = this;
+      axios.post('auth/logout', {}).then(function (response) {
+        self.update(response.data);
+      });
+    },
+  },
+});
 
 const mode = new Vue({
   el: '#mode',
@@ -16,6 +57,10 @@ const mode = new Vue({
     modeNow: function() { return this.mode == "now"; },
     modeMinPV: function() { return this.mode == "minpv"; },
     modePV: function() { return this.mode == "pv"; },
+    modeCheap: function() { return this.mode == "cheap"; },
+    modeClean: function() { return this.mode == "clean"; },
+    modeFeedInLimit: function() { return this.mode == "feedinlimit"; },
+    readOnly: function() { return auth.role == "readonly"; },
   },
   methods: {
     setMode: function (val) {
@@ -24,6 +69,12 @@ const mode = new Vue({
         self.mode = response.data.mode;
       });
     },
+    refresh: function () {
+      const self = this;
+      axios.get('mode').then(function (response) {
+        self.mode = response.data.mode;
+      });
+    },
   },
   created: function() {
     const loc = baseurl || window.location;
@@ -37,6 +88,12 @@ const mode = new Vue({
     axios.interceptors.response.use(function (response) {
       return response;
     }, function (error) {
+      // request login
+      if (error.response && error.response.status == 401) {
+        auth.update({ enabled: true, role: "" });
+        return Promise.reject(error);
+      }
+
       self.error = error;
       window.setTimeout(function () {
         if (self.error == error) { self.error = ""; }
@@ -45,16 +102,17 @@ const mode = new Vue({
     });
   },
   mounted: function() {
-    const self = this;
-    axios.get('mode').then(function (response) {
-      self.mode = response.data.mode;
+    axios.get('auth').then(function (response) {
+      auth.update(response.data);
     });
+    this.refresh();
   },
 });
 
 const live = new Vue({
   el: '#live',
   data: {
+    loadpoint: null,
     gridPower: null,
     pvPower: null,
     chargeCurrent: null,
@@ -62,6 +120,15 @@ const live = new Vue({
     chargeDuration: null,
     chargedEnergy: null,
     socCharge: null,
+    status: null,
+    enabled: null,
+    targetCurrent: null,
+    solarPercentage: null,
+    chargeCost: null,
+    chargeSavings: null,
+    currency: null,
+    chargeCO2: null,
+    dryRun: null,
   },
   computed: {
     gridMode: function () {
@@ -76,16 +143,34 @@ const live = new Vue({
     unit: function (val) {
       return (Math.abs(val) >= 1e3) ? "k" : "";
     },
+    formatCost: function (val) {
+      return (val || 0).toFixed(2) + (this.currency ? " " + this.currency : "");
+    },
+    formatDuration: function (secs) {
+      if (secs === null) {
+        return "";
+      }
+      secs = Math.round(secs);
+      const pad = function (n) { return ("0" + n).slice(-2); };
+      return pad(Math.floor(secs / 3600)) + ":" + pad(Math.floor(secs / 60) % 60) + ":" + pad(secs % 60);
+    },
     update: function (msg) {
-      Object.keys(msg).forEach(function (k) {
-        if (this[k] !== undefined) {
-          this[k] = msg[k];
-        } else if (mode[k] !== undefined) {
-          mode[k] = msg[k]; // send to mode app
-        } else {
-          console.error("invalid data key: " + k)
-        }
-      }, this);
+      // display first loadpoint only
+      if (this.loadpoint === null) {
+        this.loadpoint = msg.loadpoint;
+      }
+      if (msg.loadpoint !== this.loadpoint) {
+        return;
+      }
+
+      const k = msg.key;
+      if (this[k] !== undefined) {
+        this[k] = msg.val;
+      } else if (mode[k] !== undefined) {
+        mode[k] = msg.val; // send to mode app
+      } else {
+        console.error("invalid data key: " + k)
+      }
     },
     connect: function () {
       const loc = baseurl || window.location;
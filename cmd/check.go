@@ -0,0 +1,400 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/andig/evcc/api"
+	"github.com/andig/evcc/core"
+	"github.com/andig/evcc/provider"
+	"github.com/andig/evcc/server"
+	"github.com/kballard/go-shellquote"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// checkCmd validates the configuration without connecting to any device
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Validate configuration",
+	Run:   runCheck,
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+}
+
+func runCheck(cmd *cobra.Command, args []string) {
+	if cfgFile == "" {
+		fmt.Println("missing evcc config")
+		os.Exit(1)
+	}
+
+	var conf config
+	if err := viper.UnmarshalExact(&conf); err != nil {
+		fmt.Printf("%s: %v\n", cfgFile, err)
+		os.Exit(1)
+	}
+
+	errs := checkConfig(conf)
+	for _, err := range errs {
+		fmt.Printf("%s: %v\n", cfgFile, err)
+	}
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s: ok\n", cfgFile)
+}
+
+// configErrors collects configuration errors prefixed with their yaml path
+type configErrors []error
+
+func (e *configErrors) add(path string, format string, a ...interface{}) {
+	*e = append(*e, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, a...)))
+}
+
+// checkConfig validates the configuration and returns all errors found
+func checkConfig(conf config) []error {
+	var errs configErrors
+
+	if _, err := server.NewAuth(conf.Auth.Users, conf.Auth.Tokens, conf.Auth.Origins, conf.TLS.Cert != ""); err != nil {
+		errs.add("auth", "%v", err)
+	}
+	if (conf.TLS.Cert == "") != (conf.TLS.Key == "") {
+		errs.add("tls", "requires cert and key")
+	}
+	if conf.Influx.URL != "" {
+		if _, err := server.NewInflux(conf.Influx); err != nil {
+			errs.add("influx", "%v", err)
+		}
+	}
+
+	if conf.Sim != nil {
+		if _, err := provider.NewSim(*conf.Sim); err != nil {
+			errs.add("sim", "%v", err)
+		}
+	}
+
+	meters := checkMeters(&errs, conf)
+	chargers := checkChargers(&errs, conf)
+	vehicles := checkVehicles(&errs, conf)
+	checkTariff(&errs, conf)
+	checkForecasts(&errs, conf)
+
+	if len(conf.LoadPoints) == 0 {
+		errs.add("loadpoints", "missing loadpoint configuration")
+	}
+
+	names := make(map[string]bool)
+	for i, lpc := range conf.LoadPoints {
+		path := fmt.Sprintf("loadpoints[%d]", i)
+
+		if lpc.Name == "" {
+			errs.add(path+".name", "missing name")
+		} else if names[lpc.Name] {
+			errs.add(path+".name", "duplicate name '%s'", lpc.Name)
+		}
+		names[lpc.Name] = true
+
+		charger, ok := chargers[lpc.Charger]
+		if !ok {
+			errs.add(path+".charger", "unknown charger '%s'", lpc.Charger)
+		}
+
+		for _, m := range []struct{ key, name string }{
+			{"gridmeter", lpc.GridMeter},
+			{"pvmeter", lpc.PVMeter},
+			{"chargemeter", lpc.ChargeMeter},
+		} {
+			if m.name != "" && !meters[m.name] {
+				errs.add(path+"."+m.key, "unknown meter '%s'", m.name)
+			}
+		}
+
+		if lpc.Vehicle != "" && !vehicles[lpc.Vehicle] {
+			errs.add(path+".vehicle", "unknown vehicle '%s'", lpc.Vehicle)
+		}
+
+		// chargers that failed checking are not reported again
+		checkMode := func(path string, mode api.ChargeMode) {
+			if err := checkModeSupported(conf, lpc, charger.controllable || !ok, mode); err != nil {
+				errs.add(path, "%v", err)
+			}
+		}
+
+		if lpc.Mode != "" {
+			checkMode(path+".mode", lpc.Mode)
+		}
+
+		if err := lpc.Schedule.Validate(); err != nil {
+			errs.add(path+".schedule", "%v", err)
+		} else {
+			if lpc.Schedule.Mode != "" {
+				checkMode(path+".schedule.mode", lpc.Schedule.Mode)
+			}
+			for j, e := range lpc.Schedule.Entries {
+				checkMode(fmt.Sprintf("%s.schedule.entries[%d].mode", path, j), e.Mode)
+			}
+		}
+
+		for _, d := range []struct{ key, departure string }{
+			{"cheap.departure", lpc.Cheap.Departure},
+			{"clean.departure", lpc.Clean.Departure},
+		} {
+			if d.departure == "" {
+				continue
+			}
+			if _, err := api.ParseTimeOfDay(d.departure); err != nil {
+				errs.add(path+"."+d.key, "%v", err)
+			}
+		}
+
+		if lpc.MinCurrent > 0 && lpc.MaxCurrent > 0 && lpc.MinCurrent > lpc.MaxCurrent {
+			errs.add(path+".mincurrent", "exceeds maxcurrent")
+		}
+		if charger.limiter != nil {
+			min, max := charger.limiter.CurrentLimits()
+			for _, c := range []struct {
+				key     string
+				current int64
+			}{
+				{"mincurrent", lpc.MinCurrent},
+				{"maxcurrent", lpc.MaxCurrent},
+			} {
+				if c.current > 0 && (c.current < min || c.current > max) {
+					errs.add(path+"."+c.key, "%dA outside of charger range %d-%dA", c.current, min, max)
+				}
+			}
+		}
+		if lpc.Phases < 0 || lpc.Phases > 3 {
+			errs.add(path+".phases", "invalid phases %v", lpc.Phases)
+		}
+		if lpc.Solar.Share < 0 || lpc.Solar.Share > 1 {
+			errs.add(path+".solar.share", "must be between 0 and 1")
+		}
+	}
+
+	return errs
+}
+
+// checkModeSupported checks the loadpoint configuration provides what the
+// charge mode requires, mirroring core.LoadPoint.ChargeMode
+func checkModeSupported(conf config, lpc loadPointConfig, controllable bool, mode api.ChargeMode) error {
+	if !core.ValidMode(mode) {
+		return fmt.Errorf("invalid charge mode '%s'", mode)
+	}
+
+	switch mode {
+	case api.ModeOff, api.ModeNow:
+		return nil
+	}
+
+	if !controllable {
+		return fmt.Errorf("%s mode requires charger with maxcurrent", mode)
+	}
+
+	switch mode {
+	case api.ModeMinPV, api.ModePV, api.ModeFeedInLimit, api.ModeClean:
+		if lpc.GridMeter == "" {
+			return fmt.Errorf("%s mode requires gridmeter", mode)
+		}
+	}
+
+	switch mode {
+	case api.ModeFeedInLimit:
+		if conf.MaxExport <= 0 {
+			return fmt.Errorf("%s mode requires maxexport", mode)
+		}
+	case api.ModeCheap:
+		if conf.Tariffs.Prices == nil {
+			return fmt.Errorf("%s mode requires tariffs.prices", mode)
+		}
+	case api.ModeClean:
+		if conf.Intensity == nil {
+			return fmt.Errorf("%s mode requires intensity", mode)
+		}
+	}
+
+	return nil
+}
+
+// checkProvider checks provider type and required fields
+func checkProvider(errs *configErrors, conf config, path string, pc *providerConfig, mqtt bool) {
+	if pc == nil {
+		errs.add(path, "missing provider")
+		return
+	}
+
+	switch pc.Type {
+	case "mqtt":
+		if !mqtt {
+			errs.add(path+".type", "mqtt not supported")
+		} else if pc.Topic == "" {
+			errs.add(path+".topic", "missing topic")
+		} else if conf.Mqtt.Broker == "" {
+			errs.add(path+".type", "mqtt requires mqtt.broker")
+		}
+
+	case "exec", "script":
+		if args, err := shellquote.Split(pc.Cmd); err != nil {
+			errs.add(path+".cmd", "%v", err)
+		} else if len(args) == 0 {
+			errs.add(path+".cmd", "missing cmd")
+		}
+
+	default:
+		errs.add(path+".type", "invalid provider type '%s'", pc.Type)
+	}
+}
+
+// checkMeters returns the names of all configured meters
+func checkMeters(errs *configErrors, conf config) map[string]bool {
+	names := make(map[string]bool)
+
+	for i, mc := range conf.Meters {
+		path := fmt.Sprintf("meters[%d]", i)
+
+		if mc.Name == "" {
+			errs.add(path+".name", "missing name")
+		} else if names[mc.Name] {
+			errs.add(path+".name", "duplicate name '%s'", mc.Name)
+		}
+		names[mc.Name] = true
+
+		if mc.Type == "sim" {
+			switch mc.Usage {
+			case "grid", "pv", "charge":
+			default:
+				errs.add(path+".usage", "invalid sim meter usage '%s'", mc.Usage)
+			}
+			continue
+		}
+
+		checkProvider(errs, conf, path+".power", mc.Power, true)
+		if mc.Energy != nil {
+			checkProvider(errs, conf, path+".energy", mc.Energy, true)
+		}
+	}
+
+	return names
+}
+
+// checkedCharger is a configured charger's capabilities
+type checkedCharger struct {
+	controllable bool
+	limiter      api.CurrentLimiter // nil if current range is not known
+}
+
+// checkChargers returns the capabilities of all configured chargers by name
+func checkChargers(errs *configErrors, conf config) map[string]checkedCharger {
+	names := make(map[string]checkedCharger)
+
+	for i, cc := range conf.Chargers {
+		path := fmt.Sprintf("chargers[%d]", i)
+
+		if cc.Name == "" {
+			errs.add(path+".name", "missing name")
+		} else if _, ok := names[cc.Name]; ok {
+			errs.add(path+".name", "duplicate name '%s'", cc.Name)
+		}
+
+		switch cc.Type {
+		case "wallbe":
+			if cc.URI == "" {
+				errs.add(path+".uri", "missing uri")
+			}
+			c, err := provider.NewWallbe(cc.URI, cc.Failsafe)
+			if err != nil {
+				errs.add(path+".failsafe", "%v", err)
+			}
+			limiter, _ := c.(api.CurrentLimiter)
+			names[cc.Name] = checkedCharger{controllable: true, limiter: limiter}
+
+		case "sim":
+			names[cc.Name] = checkedCharger{controllable: true}
+
+		case "configurable":
+			checkProvider(errs, conf, path+".status", cc.Status, false)
+			checkProvider(errs, conf, path+".actualcurrent", cc.ActualCurrent, true)
+			checkProvider(errs, conf, path+".enabled", cc.Enabled, false)
+			checkProvider(errs, conf, path+".enable", cc.Enable, false)
+			if cc.MaxCurrent != nil {
+				checkProvider(errs, conf, path+".maxcurrent", cc.MaxCurrent, false)
+			}
+			names[cc.Name] = checkedCharger{controllable: cc.MaxCurrent != nil}
+
+		default:
+			errs.add(path+".type", "invalid charger type '%s'", cc.Type)
+			names[cc.Name] = checkedCharger{controllable: true}
+		}
+	}
+
+	return names
+}
+
+// checkVehicles returns the names of all configured vehicles
+func checkVehicles(errs *configErrors, conf config) map[string]bool {
+	names := make(map[string]bool)
+
+	for i, vc := range conf.Vehicles {
+		path := fmt.Sprintf("vehicles[%d]", i)
+
+		if vc.Name == "" {
+			errs.add(path+".name", "missing name")
+		} else if names[vc.Name] {
+			errs.add(path+".name", "duplicate name '%s'", vc.Name)
+		}
+		names[vc.Name] = true
+
+		if vc.Type != "" && vc.Type != "sim" {
+			errs.add(path+".type", "invalid vehicle type '%s'", vc.Type)
+		}
+	}
+
+	return names
+}
+
+func checkTariff(errs *configErrors, conf config) {
+	pc := conf.Tariffs.Prices
+	if pc == nil {
+		return
+	}
+
+	switch pc.Type {
+	case "dayahead":
+		if pc.URI == "" {
+			errs.add("tariffs.prices.uri", "missing uri")
+		}
+	case "timeofuse":
+		if _, err := provider.NewTimeOfUse(pc.Price, pc.Rates); err != nil {
+			errs.add("tariffs.prices.rates", "%v", err)
+		}
+	default:
+		errs.add("tariffs.prices.type", "invalid tariff type '%s'", pc.Type)
+	}
+}
+
+func checkForecasts(errs *configErrors, conf config) {
+	if conf.Intensity != nil && conf.Intensity.URI == "" {
+		errs.add("intensity.uri", "missing uri")
+	}
+
+	fc := conf.Forecast
+	if fc == nil {
+		return
+	}
+
+	switch fc.Type {
+	case "forecastsolar":
+		if fc.URI == "" {
+			errs.add("forecast.uri", "missing uri")
+		}
+	case "file":
+		if fc.File == "" {
+			errs.add("forecast.file", "missing file")
+		}
+	default:
+		errs.add("forecast.type", "invalid forecast type '%s'", fc.Type)
+	}
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func parseConfig(t *testing.T, yaml string) config {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewBufferString(yaml)); err != nil {
+		t.Fatal(err)
+	}
+
+	var conf config
+	if err := v.UnmarshalExact(&conf); err != nil {
+		t.Fatal(err)
+	}
+
+	return conf
+}
+
+func TestCheckConfig(t *testing.T) {
+	conf := parseConfig(t, `
+meters:
+- name: grid
+  power:
+    type: mqtt
+    topic: grid/power
+- name: pv
+  power:
+    type: exec
+    cmd: "echo 'unterminated"
+chargers:
+- name: wb
+  type: configurable
+  status:
+    type: mqtt
+    topic: status
+  actualcurrent:
+    type: exec
+    cmd: echo 16
+  enabled:
+    type: exec
+    cmd: echo true
+loadpoints:
+- name: lp1
+  charger: wb
+  gridmeter: netz
+  mode: turbo
+- name: lp1
+  charger: wallbe
+  mode: pv
+  schedule:
+    entries:
+    - from: "22:00"
+      to: "06:00"
+      mode: cheap
+`)
+
+	expected := []string{
+		"meters[0].power.type: mqtt requires mqtt.broker",
+		"meters[1].power.cmd: Unterminated single-quoted string",
+		"chargers[0].status.type: mqtt not supported",
+		"chargers[0].enable: missing provider",
+		"loadpoints[0].gridmeter: unknown meter 'netz'",
+		"loadpoints[0].mode: invalid charge mode 'turbo'",
+		"loadpoints[1].name: duplicate name 'lp1'",
+		"loadpoints[1].charger: unknown charger 'wallbe'",
+		"loadpoints[1].mode: pv mode requires gridmeter",
+		"loadpoints[1].schedule.entries[0].mode: cheap mode requires tariffs.prices",
+	}
+
+	var errs []string
+	for _, err := range checkConfig(conf) {
+		errs = append(errs, err.Error())
+	}
+
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
+
+func TestCheckConfigControllable(t *testing.T) {
+	conf := parseConfig(t, `
+meters:
+- name: grid
+  power:
+    type: exec
+    cmd: echo 0
+chargers:
+- name: wb
+  type: configurable
+  status:
+    type: exec
+    cmd: echo C
+  actualcurrent:
+    type: exec
+    cmd: echo 16
+  enabled:
+    type: exec
+    cmd: echo true
+  enable:
+    type: exec
+    cmd: echo ${enable}
+loadpoints:
+- name: lp1
+  charger: wb
+  gridmeter: grid
+  mode: minpv
+`)
+
+	errs := checkConfig(conf)
+	if len(errs) != 1 || errs[0].Error() != "loadpoints[0].mode: minpv mode requires charger with maxcurrent" {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestCheckConfigCurrentLimits(t *testing.T) {
+	conf := parseConfig(t, `
+chargers:
+- name: wb
+  type: wallbe
+  uri: 192.168.0.8:502
+loadpoints:
+- name: lp1
+  charger: wb
+  mincurrent: 5
+  maxcurrent: 40
+`)
+
+	var errs []string
+	for _, err := range checkConfig(conf) {
+		errs = append(errs, err.Error())
+	}
+
+	expected := []string{
+		"loadpoints[0].mincurrent: 5A outside of charger range 6-32A",
+		"loadpoints[0].maxcurrent: 40A outside of charger range 6-32A",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
+
+func TestCheckDistConfig(t *testing.T) {
+	b, err := ioutil.ReadFile("../evcc.dist.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := checkConfig(parseConfig(t, string(b))); len(errs) > 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
@@ -4,11 +4,11 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"sync"
 
 	"github.com/andig/evcc/api"
 	"github.com/andig/evcc/core"
 	"github.com/andig/evcc/provider"
+	"github.com/andig/evcc/store"
 	"github.com/spf13/viper"
 )
 
@@ -27,16 +27,27 @@ type compositeMeter struct {
 // MQTT singleton
 var mq *provider.MqttClient
 
-func observeLoadPoints() {
-	var wg sync.WaitGroup
-	for _, lp := range loadPoints {
-		wg.Add(1)
-		go func(lp *core.LoadPoint) {
-			observeLoadPoint(lp)
-			wg.Done()
-		}(lp)
+// database singleton
+var db *store.Store
+
+// simulated site singleton
+var sim *provider.Sim
+
+// simulator returns the simulated site shared by all sim devices
+func simulator(conf config) (*provider.Sim, error) {
+	if sim == nil {
+		var sc provider.SimConfig
+		if conf.Sim != nil {
+			sc = *conf.Sim
+		}
+
+		s, err := provider.NewSim(sc)
+		if err != nil {
+			return nil, err
+		}
+		sim = s
 	}
-	wg.Wait()
+	return sim, nil
 }
 
 func clientID() string {
@@ -44,7 +55,7 @@ func clientID() string {
 	return fmt.Sprintf("evcc-%d", pid)
 }
 
-func configureLoadPoint(lp *core.LoadPoint, lpc loadPointConfig) {
+func configureLoadPoint(lp *core.LoadPoint, lpc loadPointConfig) error {
 	if lpc.Mode != "" {
 		lp.Mode = api.ChargeMode(lpc.Mode)
 	}
@@ -60,99 +71,316 @@ func configureLoadPoint(lp *core.LoadPoint, lpc loadPointConfig) {
 	if lpc.Phases > 0 {
 		lp.Phases = lpc.Phases
 	}
+
+	// defaults are adjusted to the charger's supported range
+	if l, ok := lp.Charger.(api.CurrentLimiter); ok {
+		min, max := l.CurrentLimits()
+		if lpc.MinCurrent == 0 && lp.MinCurrent < min {
+			lp.MinCurrent = min
+		}
+		if lpc.MaxCurrent == 0 && lp.MaxCurrent > max {
+			lp.MaxCurrent = max
+		}
+		if lp.MinCurrent < min || lp.MaxCurrent > max {
+			return fmt.Errorf("currents %d-%dA outside of charger range %d-%dA", lp.MinCurrent, lp.MaxCurrent, min, max)
+		}
+	}
+
+	lp.Cheap.PriceLimit = lpc.Cheap.PriceLimit
+	lp.Cheap.Duration = lpc.Cheap.Duration
+	if lpc.Cheap.Departure != "" {
+		departure, err := api.ParseTimeOfDay(lpc.Cheap.Departure)
+		if err != nil {
+			return err
+		}
+		lp.Cheap.Departure = departure
+	}
+
+	lp.Clean.CO2Limit = lpc.Clean.CO2Limit
+	lp.Clean.Duration = lpc.Clean.Duration
+	if lpc.Clean.Departure != "" {
+		departure, err := api.ParseTimeOfDay(lpc.Clean.Departure)
+		if err != nil {
+			return err
+		}
+		lp.Clean.Departure = departure
+	}
+
+	lp.Solar.Energy = lpc.Solar.Energy
+	if lpc.Solar.Horizon > 0 {
+		lp.Solar.Horizon = lpc.Solar.Horizon
+	}
+	if lpc.Solar.Share > 0 {
+		lp.Solar.Share = lpc.Solar.Share
+	}
+
+	lp.Smoothing = lpc.Smoothing
+	lp.Safe = lpc.Shutdown
+
+	return lp.SetSchedule(lpc.Schedule)
 }
 
-func configureMeters(conf config) (meters map[string]api.Meter) {
-	meters = make(map[string]api.Meter)
+func configureMeters(conf config) (map[string]api.Meter, error) {
+	meters := make(map[string]api.Meter)
 	for _, mc := range conf.Meters {
-		m := core.NewMeter(
-			floatProvider(mc.Power),
-		)
-
-		if mc.Energy != nil {
-			m = &compositeMeter{
-				m,
-				core.NewMeterEnergy(floatProvider(mc.Energy)),
-			}
+		m, err := configureMeter(conf, mc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", mc.Name, err)
 		}
 		meters[mc.Name] = m
 	}
-	return
+	return meters, nil
+}
+
+func configureMeter(conf config, mc meterConfig) (api.Meter, error) {
+	if mc.Type == "sim" {
+		return simMeter(conf, mc.Usage)
+	}
+
+	power, err := floatProvider(mc.Power)
+	if err != nil {
+		return nil, err
+	}
+	m := core.NewMeter(
+		provider.MeasuredFloatProvider(mc.Name+".power", power),
+	)
+
+	if mc.Energy != nil {
+		energy, err := floatProvider(mc.Energy)
+		if err != nil {
+			return nil, err
+		}
+		m = &compositeMeter{
+			m,
+			core.NewMeterEnergy(provider.MeasuredFloatProvider(mc.Name+".energy", energy)),
+		}
+	}
+	return m, nil
 }
 
-func configureChargers(conf config) (chargers map[string]api.Charger) {
-	chargers = make(map[string]api.Charger)
+// simMeter returns the simulated site's meter for given usage
+func simMeter(conf config, usage string) (api.Meter, error) {
+	s, err := simulator(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	switch usage {
+	case "grid":
+		return s.GridMeter(), nil
+	case "pv":
+		return s.PVMeter(), nil
+	case "charge":
+		return s.ChargeMeter(), nil
+	default:
+		return nil, fmt.Errorf("invalid sim meter usage '%s'", usage)
+	}
+}
+
+func configureChargers(conf config) (map[string]api.Charger, error) {
+	chargers := make(map[string]api.Charger)
 	for _, cc := range conf.Chargers {
-		var c api.Charger
-
-		switch cc.Type {
-		case "wallbe":
-			c = provider.NewWallbe(cc.URI)
-
-		case "configurable":
-			c = core.NewCharger(
-				stringProvider(cc.Status),
-				intProvider(cc.ActualCurrent),
-				boolProvider(cc.Enabled),
-				boolSetter("enable", cc.Enable),
-			)
-
-			// if chargecontroller specified build composite charger
-			if cc.MaxCurrent != nil {
-				c = &compositeCharger{
-					c,
-					core.NewChargeController(
-						intSetter("current", cc.MaxCurrent),
-					),
-				}
+		c, err := configureCharger(conf, cc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", cc.Name, err)
+		}
+		chargers[cc.Name] = c
+	}
+	return chargers, nil
+}
+
+func configureCharger(conf config, cc chargerConfig) (api.Charger, error) {
+	var c api.Charger
+
+	switch cc.Type {
+	case "wallbe":
+		var err error
+		if c, err = provider.NewWallbe(cc.URI, cc.Failsafe); err != nil {
+			return nil, err
+		}
+
+		// heartbeat is sent once per update cycle
+		if fs := cc.Failsafe; fs != nil && fs.Timeout < 2*conf.Intervals.withDefaults().Update {
+			log.Printf("%s: failsafe timeout %v too short for update interval", cc.Name, fs.Timeout)
+		}
+
+	case "sim":
+		s, err := simulator(conf)
+		if err != nil {
+			return nil, err
+		}
+		c = s
+
+	case "configurable":
+		status, err := stringProvider(cc.Status)
+		if err != nil {
+			return nil, err
+		}
+		current, err := intProvider(cc.ActualCurrent)
+		if err != nil {
+			return nil, err
+		}
+		enabled, err := boolProvider(cc.Enabled)
+		if err != nil {
+			return nil, err
+		}
+		enable, err := boolSetter("enable", cc.Enable)
+		if err != nil {
+			return nil, err
+		}
+
+		c = core.NewCharger(
+			provider.MeasuredStringProvider(cc.Name+".status", status),
+			provider.MeasuredIntProvider(cc.Name+".actualcurrent", current),
+			provider.MeasuredBoolProvider(cc.Name+".enabled", enabled),
+			enable,
+		)
+
+		// if chargecontroller specified build composite charger
+		if cc.MaxCurrent != nil {
+			maxCurrent, err := intSetter("current", cc.MaxCurrent)
+			if err != nil {
+				return nil, err
+			}
+
+			c = &compositeCharger{
+				c,
+				core.NewChargeController(maxCurrent),
 			}
-		default:
-			log.Fatalf("invalid charger type '%s'", cc.Type)
 		}
+	default:
+		return nil, fmt.Errorf("invalid charger type '%s'", cc.Type)
+	}
 
-		chargers[cc.Name] = c
+	return c, nil
+}
+
+func configureTariff(conf config) (api.Tariff, error) {
+	pc := conf.Tariffs.Prices
+	if pc == nil {
+		return nil, nil
+	}
+
+	switch pc.Type {
+	case "dayahead":
+		return provider.NewDayAhead(pc.URI, pc.Markup), nil
+
+	case "timeofuse":
+		t, err := provider.NewTimeOfUse(pc.Price, pc.Rates)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time of use tariff: %v", err)
+		}
+		return t, nil
+
+	default:
+		return nil, fmt.Errorf("invalid tariff type '%s'", pc.Type)
 	}
-	return
 }
 
-func loadConfig(conf config) {
+func configureIntensity(conf config) api.Intensity {
+	if conf.Intensity == nil {
+		return nil
+	}
+	return provider.NewCarbonIntensity(conf.Intensity.URI)
+}
+
+func configureForecast(conf config) (api.Forecast, error) {
+	fc := conf.Forecast
+	if fc == nil {
+		return nil, nil
+	}
+
+	switch fc.Type {
+	case "forecastsolar":
+		return provider.NewForecastSolar(fc.URI), nil
+	case "file":
+		return provider.NewForecastFile(fc.File), nil
+	default:
+		return nil, fmt.Errorf("invalid forecast type '%s'", fc.Type)
+	}
+}
+
+func configureVehicle(conf config, vc vehicleConfig) (api.Vehicle, error) {
+	title := vc.Title
+	if title == "" {
+		title = vc.Name
+	}
+
+	if vc.Type == "sim" {
+		s, err := simulator(conf)
+		if err != nil {
+			return nil, err
+		}
+		return s.Vehicle(title), nil
+	}
+
+	return core.NewVehicle(title, vc.Capacity), nil
+}
+
+// readConfig parses the config file and exits reporting all errors if invalid
+func readConfig() (conf config) {
+	if cfgFile == "" {
+		log.Fatal("missing evcc config")
+	}
+
+	if err := viper.Unmarshal(&conf); err != nil {
+		log.Fatalf("config: failed parsing config file %s: %v", cfgFile, err)
+	}
+
+	// report all errors before connecting to devices
+	if errs := checkConfig(conf); len(errs) > 0 {
+		for _, err := range errs {
+			log.Printf("config: %v", err)
+		}
+		log.Fatalf("config: %d error(s) in %s, see 'evcc check'", len(errs), cfgFile)
+	}
+
+	return conf
+}
+
+func configureMqtt(conf config) {
 	if viper.Get("mqtt") != nil {
 		mq = provider.NewMqttClient(conf.Mqtt.Broker, conf.Mqtt.User, conf.Mqtt.Password, clientID(), true, 1)
 	}
+}
 
-	meters := configureMeters(conf)
-	chargers := configureChargers(conf)
+func loadConfig(conf config) {
+	configureMqtt(conf)
+
+	if conf.Database != "" {
+		var err error
+		if db, err = store.Open(conf.Database); err != nil {
+			log.Fatalf("failed opening database %s: %v", conf.Database, err)
+		}
+	}
+
+	if conf.DryRun {
+		log.Println("dry run: chargers are not controlled")
+	}
+
+	var err error
+	if active, err = configureSite(conf, nil); err != nil {
+		log.Fatal(err)
+	}
 
 	for _, lpc := range conf.LoadPoints {
-		charger, ok := chargers[lpc.Charger]
-		if !ok {
-			log.Fatalf("invalid charger '%s'", lpc.Charger)
+		lp, err := newLoadPoint(active, lpc)
+		if err != nil {
+			log.Fatal(err)
 		}
-		lp := core.NewLoadPoint(
-			lpc.Name,
-			charger,
-		)
 
-		// assign meters
-		for _, m := range []struct {
-			key   string
-			meter *api.Meter
-		}{
-			{lpc.GridMeter, &lp.GridMeter},
-			{lpc.ChargeMeter, &lp.ChargeMeter},
-			{lpc.PVMeter, &lp.PVMeter},
-		} {
-			if m.key != "" {
-				if impl, ok := meters[m.key]; ok {
-					*m.meter = impl
-				} else {
-					log.Fatalf("invalid meter '%s'", m.key)
-				}
+		// restore state saved before restart
+		if db != nil {
+			lp.Sessions = db
+			lp.StateStore = db
+
+			if state, err := db.LoadState(lp.Name); err != nil {
+				log.Printf("%s failed restoring state: %v", lp.Name, err)
+			} else if state != nil {
+				lp.Restore(*state)
 			}
 		}
 
-		// assign remaing config
-		configureLoadPoint(lp, lpc)
 		loadPoints = append(loadPoints, lp)
 	}
 }
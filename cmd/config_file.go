@@ -1,15 +1,78 @@
 package cmd
 
-import "github.com/andig/evcc/api"
+import (
+	"time"
+
+	"github.com/andig/evcc/api"
+	"github.com/andig/evcc/core"
+	"github.com/andig/evcc/provider"
+	"github.com/andig/evcc/server"
+)
 
 type config struct {
 	URI        string
+	Database   string
+	DryRun     bool // log charger changes instead of applying them
+	Auth       authConfig
+	TLS        tlsConfig
+	Influx     server.InfluxConfig
+	Tariffs    tariffsConfig
+	Intensity  *intensityConfig
+	Forecast   *forecastConfig
+	MaxExport  float64 // W, site feed-in limit
+	Intervals  intervalsConfig
+	Shutdown   shutdownConfig
 	Mqtt       mqttConfig
+	Sim        *provider.SimConfig // simulated site for sim devices
 	Meters     []meterConfig
 	Chargers   []chargerConfig
+	Vehicles   []vehicleConfig
 	LoadPoints []loadPointConfig
 }
 
+type intervalsConfig struct {
+	Update   time.Duration // loadpoint control
+	Observe  time.Duration // publishing values
+	Watchdog time.Duration // report update cycles running longer
+}
+
+// withDefaults returns intervals with unset values replaced by defaults
+func (c intervalsConfig) withDefaults() intervalsConfig {
+	if c.Update <= 0 {
+		c.Update = 5 * time.Second
+	}
+	if c.Observe <= 0 {
+		c.Observe = time.Second
+	}
+	if c.Watchdog <= 0 {
+		c.Watchdog = 3 * c.Update
+	}
+	return c
+}
+
+type shutdownConfig struct {
+	Timeout time.Duration // deadline for stopping gracefully
+}
+
+// withDefaults returns shutdown config with unset values replaced by defaults
+func (c shutdownConfig) withDefaults() shutdownConfig {
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return c
+}
+
+type authConfig struct {
+	Users   []server.User
+	Tokens  []server.Token
+	Origins []string
+}
+
+type tlsConfig struct {
+	Cert string
+	Key  string
+}
+
 type mqttConfig struct {
 	Broker   string
 	User     string
@@ -19,6 +82,7 @@ type mqttConfig struct {
 type meterConfig struct {
 	Name   string
 	Type   string
+	Usage  string // sim meter: grid, pv or charge
 	Power  *providerConfig
 	Energy *providerConfig
 }
@@ -34,7 +98,8 @@ type chargerConfig struct {
 	Type string
 
 	// wallbe charger
-	URI string
+	URI      string
+	Failsafe *provider.WallbeFailsafe
 
 	// composite charger
 	Status        *providerConfig // Charger
@@ -44,12 +109,74 @@ type chargerConfig struct {
 	Enabled       *providerConfig // Charger
 }
 
+type tariffsConfig struct {
+	Grid     float64
+	FeedIn   float64
+	Currency string
+	Prices   *priceConfig // dynamic grid prices
+}
+
+type priceConfig struct {
+	Type string
+
+	// dayahead
+	URI    string
+	Markup float64
+
+	// timeofuse
+	Price float64
+	Rates []provider.TimeOfUseRate
+}
+
+// intensityConfig is a CO2 intensity forecast in carbonintensity.org.uk format
+type intensityConfig struct {
+	URI string
+}
+
+type forecastConfig struct {
+	Type string
+	URI  string // forecastsolar
+	File string // file
+}
+
+type cheapConfig struct {
+	PriceLimit float64
+	Duration   time.Duration
+	Departure  string
+}
+
+type cleanConfig struct {
+	CO2Limit  float64
+	Duration  time.Duration
+	Departure string
+}
+
+type solarConfig struct {
+	Energy  float64 // Wh
+	Horizon time.Duration
+	Share   float64
+}
+
+type vehicleConfig struct {
+	Name     string
+	Type     string
+	Title    string
+	Capacity int64
+}
+
 type loadPointConfig struct {
 	Name        string
 	Charger     string // api.Charger
 	GridMeter   string // api.Meter
 	PVMeter     string // api.Meter
 	ChargeMeter string // api.Meter
+	Vehicle     string // api.Vehicle
+	Cheap       cheapConfig
+	Clean       cleanConfig
+	Solar       solarConfig
+	Schedule    core.Schedule
+	Smoothing   core.Smoothing
+	Shutdown    core.SafeState
 	Mode        api.ChargeMode
 	MinCurrent  int64
 	MaxCurrent  int64
@@ -1,78 +1,88 @@
 package cmd
 
 import (
-	"log"
+	"errors"
+	"fmt"
 
 	"github.com/andig/evcc/api"
 	"github.com/andig/evcc/provider"
 )
 
-func stringProvider(pc *providerConfig) (res api.StringProvider) {
+// errMqtt is returned for mqtt providers without connected mqtt client
+var errMqtt = errors.New("mqtt not configured")
+
+func stringProvider(pc *providerConfig) (res api.StringProvider, err error) {
 	switch pc.Type {
 	case "exec", "script":
 		exec := &provider.Exec{}
 		res = exec.StringProvider(pc.Cmd)
 	default:
-		log.Fatalf("invalid provider type %s", pc.Type)
+		err = fmt.Errorf("invalid provider type %s", pc.Type)
 	}
 	return
 }
 
-func boolProvider(pc *providerConfig) (res api.BoolProvider) {
+func boolProvider(pc *providerConfig) (res api.BoolProvider, err error) {
 	switch pc.Type {
 	case "exec", "script":
 		exec := &provider.Exec{}
 		res = exec.BoolProvider(pc.Cmd)
 	default:
-		log.Fatalf("invalid provider type %s", pc.Type)
+		err = fmt.Errorf("invalid provider type %s", pc.Type)
 	}
 	return
 }
 
-func intProvider(pc *providerConfig) (res api.IntProvider) {
+func intProvider(pc *providerConfig) (res api.IntProvider, err error) {
 	switch pc.Type {
 	case "mqtt":
+		if mq == nil {
+			return nil, errMqtt
+		}
 		res = mq.IntProvider(pc.Topic)
 	case "exec", "script":
 		exec := &provider.Exec{}
 		res = exec.IntProvider(pc.Cmd)
 	default:
-		log.Fatalf("invalid provider type %s", pc.Type)
+		err = fmt.Errorf("invalid provider type %s", pc.Type)
 	}
 	return
 }
 
-func floatProvider(pc *providerConfig) (res api.FloatProvider) {
+func floatProvider(pc *providerConfig) (res api.FloatProvider, err error) {
 	switch pc.Type {
 	case "mqtt":
+		if mq == nil {
+			return nil, errMqtt
+		}
 		res = mq.FloatProvider(pc.Topic)
 	case "exec", "script":
 		exec := &provider.Exec{}
 		res = exec.FloatProvider(pc.Cmd)
 	default:
-		log.Fatalf("invalid provider type %s", pc.Type)
+		err = fmt.Errorf("invalid provider type %s", pc.Type)
 	}
 	return
 }
 
-func boolSetter(param string, pc *providerConfig) (res api.BoolSetter) {
+func boolSetter(param string, pc *providerConfig) (res api.BoolSetter, err error) {
 	switch pc.Type {
 	case "exec", "script":
 		exec := &provider.Exec{}
 		res = exec.BoolSetter(param, pc.Cmd)
 	default:
-		log.Fatalf("invalid setter type %s", pc.Type)
+		err = fmt.Errorf("invalid setter type %s", pc.Type)
 	}
 	return
 }
 
-func intSetter(param string, pc *providerConfig) (res api.IntSetter) {
+func intSetter(param string, pc *providerConfig) (res api.IntSetter, err error) {
 	switch pc.Type {
 	case "exec", "script":
 		exec := &provider.Exec{}
 		res = exec.IntSetter(param, pc.Cmd)
 	default:
-		log.Fatalf("invalid setter type %s", pc.Type)
+		err = fmt.Errorf("invalid setter type %s", pc.Type)
 	}
 	return
 }
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"testing"
 
+	"github.com/andig/evcc/core"
+	"github.com/andig/evcc/provider"
 	"github.com/spf13/viper"
 )
 
@@ -61,3 +63,26 @@ chargers:
 
 	// _ = configureChargers(conf)
 }
+
+func TestConfigureLoadPointLimits(t *testing.T) {
+	c, err := provider.NewWallbe("192.168.0.8:502", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// default min current is below the charger's minimum
+	lp := core.NewLoadPoint("lp1", c)
+	if err := configureLoadPoint(lp, loadPointConfig{MaxCurrent: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	if lp.MinCurrent != 6 || lp.MaxCurrent != 20 {
+		t.Errorf("expected 6-20A, got %d-%dA", lp.MinCurrent, lp.MaxCurrent)
+	}
+
+	// configured currents outside of the charger's range are rejected
+	lp = core.NewLoadPoint("lp1", c)
+	if err := configureLoadPoint(lp, loadPointConfig{MaxCurrent: 40}); err == nil {
+		t.Error("expected current range error")
+	}
+}
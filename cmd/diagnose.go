@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andig/evcc/api"
+	"github.com/andig/evcc/core"
+	"github.com/spf13/cobra"
+)
+
+// meterCmd reads the configured meters
+var meterCmd = &cobra.Command{
+	Use:   "meter [name]...",
+	Short: "Read configured meters",
+	Run:   runMeter,
+}
+
+// chargerCmd reads the configured chargers
+var chargerCmd = &cobra.Command{
+	Use:   "charger [name]...",
+	Short: "Read configured chargers",
+	Run:   runCharger,
+}
+
+// watchInterval repeats diagnostic readings if set
+var watchInterval time.Duration
+
+func init() {
+	for _, cmd := range []*cobra.Command{meterCmd, chargerCmd} {
+		cmd.Flags().DurationVarP(&watchInterval,
+			"watch", "w",
+			0,
+			"Repeat reading in given interval until interrupted",
+		)
+		rootCmd.AddCommand(cmd)
+	}
+}
+
+// selectNames returns the requested names or all configured names if none
+// are requested. Unknown names are fatal.
+func selectNames(args []string, configured []string) []string {
+	if len(args) == 0 {
+		return configured
+	}
+
+	known := make(map[string]bool)
+	for _, name := range configured {
+		known[name] = true
+	}
+
+	for _, name := range args {
+		if !known[name] {
+			fmt.Printf("unknown device '%s'\n", name)
+			os.Exit(1)
+		}
+	}
+
+	return args
+}
+
+// watch calls fn once or, if interval is set, repeatedly until interrupted
+func watch(interval time.Duration, fn func()) {
+	if interval <= 0 {
+		fn()
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	core.Repeat(ctx, "watch", interval, fn)
+}
+
+// reading formats a value or the error reading it
+func reading(w io.Writer, name, key string, val interface{}, err error) {
+	if err != nil {
+		fmt.Fprintf(w, "%s\t%s\terror: %v\n", name, key, err)
+		return
+	}
+	fmt.Fprintf(w, "%s\t%s\t%v\n", name, key, val)
+}
+
+func runMeter(cmd *cobra.Command, args []string) {
+	conf := readConfig()
+	configureMqtt(conf)
+
+	var configured []string
+	for _, mc := range conf.Meters {
+		configured = append(configured, mc.Name)
+	}
+	names := selectNames(args, configured)
+
+	meters, err := configureMeters(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	watch(watchInterval, func() {
+		printMeters(os.Stdout, names, meters)
+	})
+}
+
+// printMeters prints a reading of every interface the meters implement
+func printMeters(out io.Writer, names []string, meters map[string]api.Meter) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	for _, name := range names {
+		m := meters[name]
+
+		power, err := m.CurrentPower()
+		reading(w, name, "power", fmt.Sprintf("%.0fW", power), err)
+
+		if m, ok := m.(api.MeterEnergy); ok {
+			energy, err := m.TotalEnergy()
+			reading(w, name, "energy", fmt.Sprintf("%.0fWh", energy), err)
+		}
+	}
+
+	fmt.Fprintln(w)
+}
+
+func runCharger(cmd *cobra.Command, args []string) {
+	conf := readConfig()
+	configureMqtt(conf)
+
+	var configured []string
+	for _, cc := range conf.Chargers {
+		configured = append(configured, cc.Name)
+	}
+	names := selectNames(args, configured)
+
+	chargers, err := configureChargers(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	watch(watchInterval, func() {
+		printChargers(os.Stdout, names, chargers)
+	})
+
+	for _, c := range chargers {
+		if c, ok := c.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// printChargers prints a reading of every interface the chargers implement.
+// Chargers are only read, no settings are changed.
+func printChargers(out io.Writer, names []string, chargers map[string]api.Charger) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	for _, name := range names {
+		c := chargers[name]
+
+		status, err := c.Status()
+		reading(w, name, "status", status, err)
+
+		enabled, err := c.Enabled()
+		reading(w, name, "enabled", enabled, err)
+
+		current, err := c.ActualCurrent()
+		reading(w, name, "current", fmt.Sprintf("%dA", current), err)
+
+		_, controllable := c.(api.ChargeController)
+		reading(w, name, "controllable", controllable, nil)
+
+		if c, ok := c.(api.CurrentLimiter); ok {
+			min, max := c.CurrentLimits()
+			reading(w, name, "limits", fmt.Sprintf("%d-%dA", min, max), nil)
+		}
+	}
+
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/andig/evcc/api"
+)
+
+type testMeter struct {
+	power  float64
+	energy float64
+	err    error
+}
+
+func (m *testMeter) CurrentPower() (float64, error) {
+	return m.power, m.err
+}
+
+func (m *testMeter) TotalEnergy() (float64, error) {
+	return m.energy, nil
+}
+
+type testCharger struct{}
+
+func (c *testCharger) Status() (api.ChargeStatus, error) { return api.StatusC, nil }
+func (c *testCharger) Enabled() (bool, error)            { return true, nil }
+func (c *testCharger) Enable(enable bool) error          { panic("unexpected write") }
+func (c *testCharger) ActualCurrent() (int64, error)     { return 16, nil }
+
+func TestPrintMeters(t *testing.T) {
+	meters := map[string]api.Meter{
+		"grid":   &testMeter{power: -1500, energy: 1234.5},
+		"broken": &testMeter{err: errors.New("timeout")},
+	}
+
+	var b bytes.Buffer
+	printMeters(&b, []string{"grid", "broken"}, meters)
+
+	for _, s := range []string{"grid    power   -1500W", "grid    energy  1234Wh", "broken  power   error: timeout"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("expected %q in\n%s", s, b.String())
+		}
+	}
+}
+
+func TestPrintChargers(t *testing.T) {
+	chargers := map[string]api.Charger{
+		"wb": &testCharger{},
+	}
+
+	var b bytes.Buffer
+	printChargers(&b, []string{"wb"}, chargers)
+
+	for _, s := range []string{"wb  status        C", "wb  enabled       true", "wb  current       16A", "wb  controllable  false"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("expected %q in\n%s", s, b.String())
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/andig/evcc/core"
+	"github.com/spf13/viper"
+)
+
+// controller runs the loadpoints' control loops and applies config changes
+type controller struct {
+	mu        sync.Mutex
+	intervals intervalsConfig
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	last      config // last config applied or rejected
+	done      bool   // shut down, config changes are ignored
+}
+
+func newController(conf config) *controller {
+	return &controller{
+		intervals: conf.Intervals.withDefaults(),
+		last:      conf,
+	}
+}
+
+// start starts the control loops
+func (c *controller) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	// control and push updates per loadpoint, slow devices don't delay others
+	for _, lp := range loadPoints {
+		c.wg.Add(2)
+
+		go func(lp *core.LoadPoint) {
+			lp.Run(ctx, c.intervals.Update, c.intervals.Watchdog)
+			c.wg.Done()
+		}(lp)
+
+		go func(lp *core.LoadPoint) {
+			core.Repeat(ctx, lp.Name+" observe", c.intervals.Observe, func() {
+				observeLoadPoint(lp)
+			})
+			c.wg.Done()
+		}(lp)
+	}
+
+	// switch scheduled charge modes
+	c.wg.Add(1)
+	go func() {
+		core.NewScheduler(loadPoints).Run(ctx, 10*time.Second)
+		c.wg.Done()
+	}()
+}
+
+// stop stops the control loops and waits for running cycles to finish
+func (c *controller) stop() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+// shutdown stops the control loops permanently
+func (c *controller) shutdown() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.done = true
+	c.stop()
+}
+
+// reload applies the changed config file. Invalid configs are rejected and
+// the running configuration remains active.
+func (c *controller) reload() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.done {
+		return
+	}
+
+	// viper keeps the previous config if the file can't be read
+	var conf config
+	if err := viper.ReadInConfig(); err != nil {
+		log.Printf("config: reload rejected: %v", err)
+		return
+	}
+	if err := viper.Unmarshal(&conf); err != nil {
+		log.Printf("config: reload rejected: failed parsing config file %s: %v", cfgFile, err)
+		return
+	}
+
+	// file events are reported repeatedly per change
+	if reflect.DeepEqual(conf, c.last) {
+		return
+	}
+	c.last = conf
+
+	// rejected change reverted
+	if reflect.DeepEqual(conf, active.conf) {
+		return
+	}
+
+	if errs := checkConfig(conf); len(errs) > 0 {
+		for _, err := range errs {
+			log.Printf("config: %v", err)
+		}
+		log.Printf("config: reload rejected: %d error(s) in %s, see 'evcc check'", len(errs), cfgFile)
+		return
+	}
+
+	if err := checkReload(active.conf, conf); err != nil {
+		log.Printf("config: reload rejected: %v", err)
+		return
+	}
+
+	for _, section := range restartRequired(active.conf, conf) {
+		log.Printf("config: %s changed, restart required", section)
+	}
+
+	// devices are created before the control loops are stopped
+	next, lps, err := prepareReload(conf)
+	if err != nil {
+		log.Printf("config: reload rejected: %v", err)
+		return
+	}
+
+	log.Printf("config: reloading %s", cfgFile)
+
+	c.stop()
+	reconfigure(next, lps)
+	c.start()
+}
+
+// checkReload returns an error if the config changes can't be applied to the
+// running loadpoints
+func checkReload(prev, conf config) error {
+	if len(prev.LoadPoints) != len(conf.LoadPoints) {
+		return errors.New("loadpoints added or removed, restart required")
+	}
+
+	for i, lpc := range conf.LoadPoints {
+		if name := prev.LoadPoints[i].Name; lpc.Name != name {
+			return fmt.Errorf("loadpoint %s renamed or reordered, restart required", name)
+		}
+	}
+
+	// mqtt client is only connected on start
+	if mq == nil && usesMqtt(conf) {
+		return errors.New("mqtt providers added, restart required")
+	}
+
+	return nil
+}
+
+// usesMqtt checks if meters or chargers of conf use mqtt providers
+func usesMqtt(conf config) bool {
+	var providers []*providerConfig
+	for _, mc := range conf.Meters {
+		providers = append(providers, mc.Power, mc.Energy)
+	}
+	for _, cc := range conf.Chargers {
+		providers = append(providers, cc.Status, cc.ActualCurrent, cc.Enabled, cc.Enable, cc.MaxCurrent)
+	}
+
+	for _, pc := range providers {
+		if pc != nil && pc.Type == "mqtt" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// restartRequired returns the changed config sections only applied on start
+func restartRequired(prev, conf config) (sections []string) {
+	for _, s := range []struct {
+		name       string
+		prev, conf interface{}
+	}{
+		{"uri", prev.URI, conf.URI},
+		{"database", prev.Database, conf.Database},
+		{"auth", prev.Auth, conf.Auth},
+		{"tls", prev.TLS, conf.TLS},
+		{"influx", prev.Influx, conf.Influx},
+		{"mqtt", prev.Mqtt, conf.Mqtt},
+		{"intervals", prev.Intervals, conf.Intervals},
+		{"shutdown", prev.Shutdown, conf.Shutdown},
+	} {
+		if !reflect.DeepEqual(s.prev, s.conf) {
+			sections = append(sections, s.name)
+		}
+	}
+
+	return sections
+}
+
+// prepareReload creates the site and loadpoints of conf, devices of the active
+// site with unchanged configuration are reused. On error, the active site
+// remains unchanged.
+func prepareReload(conf config) (*site, []*core.LoadPoint, error) {
+	prevSim := sim
+
+	next, err := configureSite(conf, active)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var lps []*core.LoadPoint
+	for _, lpc := range conf.LoadPoints {
+		lp, err := newLoadPoint(next, lpc)
+		if err != nil {
+			next.close(active)
+			sim = prevSim
+			return nil, nil, err
+		}
+		lps = append(lps, lp)
+	}
+
+	return next, lps, nil
+}
+
+// reconfigure applies the site and loadpoints created by prepareReload to the
+// running loadpoints. Settings changed at runtime are kept unless their
+// configuration has changed. The control loops must not be running.
+func reconfigure(next *site, lps []*core.LoadPoint) {
+	prev := active
+
+	for i, nlp := range lps {
+		lp, lpc, prevLpc := loadPoints[i], next.conf.LoadPoints[i], prev.conf.LoadPoints[i]
+
+		// keep runtime settings, invalid ones are ignored for the new devices
+		settings, current := nlp.Settings(), lp.Settings()
+		if lpc.Mode == prevLpc.Mode {
+			settings.Mode = current.Mode
+		}
+		if lpc.MinCurrent == prevLpc.MinCurrent && lpc.MaxCurrent == prevLpc.MaxCurrent {
+			settings.MinCurrent = current.MinCurrent
+			settings.MaxCurrent = current.MaxCurrent
+		}
+		if lpc.Phases == prevLpc.Phases {
+			settings.Phases = current.Phases
+		}
+		settings.TargetSoC = current.TargetSoC
+		nlp.Restore(core.State{Settings: settings})
+
+		if reflect.DeepEqual(lpc.Schedule, prevLpc.Schedule) {
+			if err := nlp.SetSchedule(lp.Schedule()); err != nil {
+				log.Printf("%s: %v", lp.Name, err)
+			}
+		}
+
+		lp.Reconfigure(nlp)
+	}
+
+	prev.close(next)
+	active = next
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andig/evcc/api"
+)
+
+const reloadConfig = `
+sim:
+  soc: 40
+meters:
+- name: grid
+  type: sim
+  usage: grid
+- name: pv
+  type: sim
+  usage: pv
+chargers:
+- name: wb
+  type: sim
+loadpoints:
+- name: lp1
+  charger: wb
+  gridmeter: grid
+  pvmeter: pv
+  mode: pv
+`
+
+func TestReload(t *testing.T) {
+	defer func() {
+		loadPoints, active, sim = nil, nil, nil
+	}()
+
+	conf := parseConfig(t, reloadConfig)
+	loadConfig(conf)
+	lp := loadPoints[0]
+
+	reload := func(conf config) {
+		next, lps, err := prepareReload(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reconfigure(next, lps)
+	}
+
+	// runtime settings
+	if err := lp.SetMaxCurrent(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := lp.ChargeMode(api.ModeOff); err != nil {
+		t.Fatal(err)
+	}
+
+	// loadpoints can't be renamed
+	renamed := parseConfig(t, strings.Replace(reloadConfig, "name: lp1", "name: garage", 1))
+	if err := checkReload(conf, renamed); err == nil {
+		t.Error("expected rename error")
+	}
+
+	changed := parseConfig(t, reloadConfig+`
+  smoothing:
+    increase: 3
+uri: 0.0.0.0:7070
+`)
+	if err := checkReload(conf, changed); err != nil {
+		t.Fatal(err)
+	}
+	if sections := restartRequired(conf, changed); len(sections) != 1 || sections[0] != "uri" {
+		t.Errorf("expected uri to require restart, got %v", sections)
+	}
+
+	charger := lp.Charger
+	reload(changed)
+
+	if lp.Charger != charger || lp.Smoothing.Increase != 3 {
+		t.Errorf("expected unchanged charger and smoothing applied, got %+v", lp)
+	}
+	if s := lp.Settings(); s.Mode != api.ModeOff || s.MaxCurrent != 10 {
+		t.Errorf("expected runtime settings to be kept, got %+v", s)
+	}
+
+	// changed configuration overrides runtime settings
+	changed = parseConfig(t, strings.NewReplacer("soc: 40", "soc: 60", "mode: pv", "mode: now").Replace(reloadConfig))
+	reload(changed)
+
+	if lp.Charger == charger {
+		t.Error("expected sim charger to be replaced")
+	}
+	if s := lp.Settings(); s.Mode != api.ModeNow {
+		t.Errorf("expected mode now, got %+v", s)
+	}
+
+	// failing devices don't affect the running loadpoints
+	charger, simulated := lp.Charger, sim
+	mqtt := parseConfig(t, strings.NewReplacer("soc: 60", "soc: 80", "type: sim\n  usage: pv", "type: exec\n  usage: pv\n  power:\n    type: mqtt\n    topic: pv").Replace(reloadConfig))
+	if err := checkReload(changed, mqtt); err == nil {
+		t.Error("expected mqtt error")
+	}
+	if _, _, err := prepareReload(mqtt); err == nil {
+		t.Error("expected mqtt error")
+	}
+	if lp.Charger != charger || sim != simulated || active.conf.Sim.SoC != 60 {
+		t.Error("expected running configuration to be kept")
+	}
+}
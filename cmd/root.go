@@ -1,21 +1,26 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
-	"time"
+	"os/signal"
+	"syscall"
 
 	"github.com/andig/evcc/api"
 	"github.com/andig/evcc/core"
 	"github.com/andig/evcc/server"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
 	cfgFile    string
+	recordFile string
 	loadPoints []*core.LoadPoint
 	clientPush = make(chan server.SocketValue)
 )
@@ -37,11 +42,23 @@ func init() {
 	)
 	viper.BindPFlag("uri", rootCmd.PersistentFlags().Lookup("uri"))
 
+	rootCmd.PersistentFlags().Bool(
+		"dry-run",
+		false,
+		"Observe only, log charger changes instead of applying them",
+	)
+	viper.BindPFlag("dryrun", rootCmd.PersistentFlags().Lookup("dry-run"))
+
 	rootCmd.PersistentFlags().StringVarP(&cfgFile,
 		"config", "c",
 		"",
 		"Config file (default is $HOME/evcc.yaml)",
 	)
+	rootCmd.Flags().StringVar(&recordFile,
+		"record",
+		"",
+		"Record device access of loadpoints to file for replay",
+	)
 	rootCmd.PersistentFlags().BoolP(
 		"help", "h",
 		false,
@@ -99,17 +116,10 @@ func Execute() {
 	}
 }
 
-func updateLoadPoints() {
-	for _, lp := range loadPoints {
-		lp.Update()
-	}
-}
-
-func formatDuration(d time.Duration) string {
-	return fmt.Sprintf("%02d:%02d:%02d", int64(d.Hours()), int64(d.Minutes())%60, int64(d.Seconds())%60)
-}
-
 func observeLoadPoint(lp *core.LoadPoint) {
+	// reads are concurrent to update cycles and not recorded
+	charger := core.Untraced(lp.Charger).(api.Charger)
+
 	meters := map[string]api.Meter{
 		"grid":   lp.GridMeter,
 		"pv":     lp.PVMeter,
@@ -117,28 +127,62 @@ func observeLoadPoint(lp *core.LoadPoint) {
 	}
 
 	for name, meter := range meters {
+		if meter == nil {
+			continue
+		}
+		meter = core.Untraced(meter).(api.Meter)
+
 		if f, err := meter.CurrentPower(); err == nil {
 			key := name + "Power"
-			clientPush <- server.SocketValue{Key: key, Val: f}
+			clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: key, Val: f}
 		} else {
 			log.Printf("%s update %s meter failed: %v", lp.Name, name, err)
 		}
 	}
 
-	clientPush <- server.SocketValue{Key: "chargeDuration", Val: formatDuration(lp.ChargeDuration())}
-	clientPush <- server.SocketValue{Key: "mode", Val: string(lp.CurrentChargeMode())}
+	clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "chargeDuration", Val: lp.ChargeDuration()}
+	clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "mode", Val: string(lp.CurrentChargeMode())}
+	clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "targetCurrent", Val: lp.TargetCurrent()}
+
+	cost, savings := lp.ChargeCost()
+	clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "solarPercentage", Val: lp.SolarPercentage()}
+	clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "chargeCost", Val: cost}
+	clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "chargeSavings", Val: savings}
+	clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "currency", Val: lp.Tariffs.Currency}
+	clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "chargeCO2", Val: lp.ChargeCO2()}
+	clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "dryRun", Val: lp.DryRun}
+
+	if v, ok := core.Untraced(lp.Vehicle).(api.ChargeState); ok {
+		if f, err := v.ChargeState(); err == nil {
+			clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "socCharge", Val: f}
+		} else {
+			log.Printf("%s update vehicle soc failed: %v", lp.Name, err)
+		}
+	}
 
 	if f, err := lp.ChargedEnergy(); err == nil {
-		clientPush <- server.SocketValue{Key: "chargedEnergy", Val: f}
+		clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "chargedEnergy", Val: f}
 	} else {
 		log.Printf("%s update charge meter failed: %v", lp.Name, err)
 	}
 
-	if f, err := lp.Charger.ActualCurrent(); err == nil {
-		clientPush <- server.SocketValue{Key: "chargeCurrent", Val: f}
+	if f, err := charger.ActualCurrent(); err == nil {
+		clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "chargeCurrent", Val: f}
 	} else {
 		log.Printf("%s update charger current failed: %v", lp.Name, err)
 	}
+
+	if s, err := charger.Status(); err == nil {
+		clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "status", Val: string(s)}
+	} else {
+		log.Printf("%s update charger status failed: %v", lp.Name, err)
+	}
+
+	if b, err := lp.ChargerEnabled(); err == nil {
+		clientPush <- server.SocketValue{LoadPoint: lp.Name, Key: "enabled", Val: b}
+	} else {
+		log.Printf("%s update charger enabled failed: %v", lp.Name, err)
+	}
 }
 
 func run(cmd *cobra.Command, args []string) {
@@ -147,40 +191,103 @@ func run(cmd *cobra.Command, args []string) {
 		core.Logger = logger
 	}
 
-	if cfgFile != "" {
-		var conf config
-		if err := viper.UnmarshalExact(&conf); err != nil {
-			log.Fatalf("config: failed parsing config file %s: %v", cfgFile, err)
+	conf := readConfig()
+	loadConfig(conf)
+
+	if len(loadPoints) == 0 {
+		log.Fatal("missing loadpoint configuration")
+	}
+	log.Printf("%+v", loadPoints[0])
+
+	// record device access for replay
+	if recordFile != "" {
+		f, err := os.OpenFile(recordFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		rec := core.NewRecorder(f)
+		for _, lp := range loadPoints {
+			rec.Record(lp)
 		}
-		loadConfig(conf)
-	} else {
-		log.Fatal("missing evcc config")
 	}
 
-	lp := loadPoints[0]
-	log.Printf("%+v", lp)
+	// session log
+	var sessions core.SessionStore
+	if db != nil {
+		sessions = db
+	}
 
 	// create webserver
-	hub := server.NewSocketHub()
-	httpd := server.NewHttpd(viper.GetString("uri"), lp, hub)
+	secure := conf.TLS.Cert != ""
+	auth, err := server.NewAuth(conf.Auth.Users, conf.Auth.Tokens, conf.Auth.Origins, secure)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !auth.Enabled() {
+		log.Println("httpd: authentication disabled")
+	}
 
-	// start broadcasting values
-	go hub.Run(clientPush)
+	metrics, err := server.NewMetrics(prometheus.DefaultRegisterer)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// push updates
-	go func() {
-		for range time.Tick(1 * time.Second) {
-			observeLoadPoints()
+	cache := server.NewCache()
+	hub := server.NewSocketHub(loadPoints, cache)
+	httpd := server.NewHttpd(viper.GetString("uri"), loadPoints, hub, cache, sessions, auth)
+
+	values := metrics.Run(cache.Run(clientPush))
+
+	// write values to database, periodic writes end with the control loops
+	influxCtx, influxCancel := context.WithCancel(context.Background())
+	defer influxCancel()
+
+	var influx *server.Influx
+	if conf.Influx.URL != "" {
+		if influx, err = server.NewInflux(conf.Influx); err != nil {
+			log.Fatal(err)
 		}
-	}()
+		values = influx.Run(influxCtx, values)
+	}
+
+	// start broadcasting values
+	go hub.Run(values)
+
+	// run control loops, reconfigured on config file changes
+	ctrl := newController(conf)
+	ctrl.start()
 
+	viper.OnConfigChange(func(fsnotify.Event) {
+		ctrl.reload()
+	})
+	viper.WatchConfig()
+
+	errC := make(chan error, 1)
 	go func() {
-		updateLoadPoints()
-		for range time.Tick(5 * time.Second) {
-			core.Logger.Printf("---")
-			updateLoadPoints()
+		if secure {
+			errC <- httpd.ListenAndServeTLS(conf.TLS.Cert, conf.TLS.Key)
+		} else {
+			errC <- httpd.ListenAndServe()
 		}
 	}()
 
-	log.Fatal(httpd.ListenAndServe())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-errC:
+		log.Fatal(err)
+	case sig := <-signals:
+		log.Printf("received %v, shutting down", sig)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), conf.Shutdown.withDefaults().Timeout)
+	defer shutdownCancel()
+
+	shutdown(shutdownCtx, func() {
+		ctrl.shutdown()
+		influxCancel()
+	}, httpd, influx)
 }
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/andig/evcc/server"
+)
+
+// shutdown stops the control loops, leaves chargers in their safe state,
+// saves charge sessions, flushes measurements and closes connections.
+// Steps waiting for I/O are abandoned when ctx expires.
+func shutdown(ctx context.Context, stop func(), httpd *http.Server, influx *server.Influx) {
+	// stop control loops, a stuck cycle must not block shutdown
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Println("shutdown: control loops did not stop in time")
+	}
+
+	// no more changes via api
+	if err := httpd.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: httpd: %v", err)
+	}
+
+	for _, lp := range loadPoints {
+		if err := lp.Shutdown(); err != nil {
+			log.Printf("shutdown: %s: %v", lp.Name, err)
+		}
+	}
+
+	if influx != nil {
+		if err := influx.Flush(ctx); err != nil {
+			log.Printf("shutdown: influx: %v", err)
+		}
+	}
+
+	var closers []io.Closer
+	for _, lp := range loadPoints {
+		if c, ok := lp.Charger.(io.Closer); ok {
+			closers = append(closers, c)
+		}
+	}
+	if mq != nil {
+		closers = append(closers, mq)
+	}
+	if db != nil {
+		closers = append(closers, db)
+	}
+
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}
+
+	log.Println("shutdown complete")
+}
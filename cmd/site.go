@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+
+	"github.com/andig/evcc/api"
+	"github.com/andig/evcc/core"
+)
+
+// site holds the devices built from a config, referenced by loadpoints by name
+type site struct {
+	conf      config
+	meters    map[string]api.Meter
+	chargers  map[string]api.Charger
+	vehicles  map[string]api.Vehicle
+	tariff    api.Tariff
+	intensity api.Intensity
+	forecast  api.Forecast
+}
+
+// site of the running loadpoints
+var active *site
+
+// configureSite builds the devices of conf. Devices of prev with unchanged
+// configuration are reused to keep their connections and state. On error,
+// devices created are closed and prev remains usable.
+func configureSite(conf config, prev *site) (_ *site, err error) {
+	s := &site{
+		conf:     conf,
+		meters:   make(map[string]api.Meter),
+		chargers: make(map[string]api.Charger),
+		vehicles: make(map[string]api.Vehicle),
+	}
+
+	// sim devices are rebuilt with the simulated site
+	simChanged := prev != nil && !reflect.DeepEqual(prev.conf.Sim, conf.Sim)
+	if simChanged {
+		prevSim := sim
+		sim = nil
+
+		defer func() {
+			if err != nil {
+				sim = prevSim
+			}
+		}()
+	}
+
+	defer func() {
+		if err != nil {
+			s.close(prev)
+		}
+	}()
+
+	for _, mc := range conf.Meters {
+		if prev != nil && !(simChanged && mc.Type == "sim") {
+			if pmc, ok := prev.meterConfig(mc.Name); ok && reflect.DeepEqual(pmc, mc) {
+				s.meters[mc.Name] = prev.meters[mc.Name]
+				continue
+			}
+		}
+		if s.meters[mc.Name], err = configureMeter(conf, mc); err != nil {
+			return nil, fmt.Errorf("%s: %v", mc.Name, err)
+		}
+	}
+
+	for _, cc := range conf.Chargers {
+		if prev != nil && !(simChanged && cc.Type == "sim") {
+			if pcc, ok := prev.chargerConfig(cc.Name); ok && reflect.DeepEqual(pcc, cc) {
+				s.chargers[cc.Name] = prev.chargers[cc.Name]
+				continue
+			}
+		}
+		if s.chargers[cc.Name], err = configureCharger(conf, cc); err != nil {
+			return nil, fmt.Errorf("%s: %v", cc.Name, err)
+		}
+	}
+
+	for _, vc := range conf.Vehicles {
+		if prev != nil && !(simChanged && vc.Type == "sim") {
+			if pvc, ok := prev.vehicleConfig(vc.Name); ok && reflect.DeepEqual(pvc, vc) {
+				s.vehicles[vc.Name] = prev.vehicles[vc.Name]
+				continue
+			}
+		}
+		if s.vehicles[vc.Name], err = configureVehicle(conf, vc); err != nil {
+			return nil, fmt.Errorf("%s: %v", vc.Name, err)
+		}
+	}
+
+	if prev != nil && reflect.DeepEqual(prev.conf.Tariffs.Prices, conf.Tariffs.Prices) {
+		s.tariff = prev.tariff
+	} else if s.tariff, err = configureTariff(conf); err != nil {
+		return nil, err
+	}
+
+	if prev != nil && reflect.DeepEqual(prev.conf.Intensity, conf.Intensity) {
+		s.intensity = prev.intensity
+	} else {
+		s.intensity = configureIntensity(conf)
+	}
+
+	if prev != nil && reflect.DeepEqual(prev.conf.Forecast, conf.Forecast) {
+		s.forecast = prev.forecast
+	} else if s.forecast, err = configureForecast(conf); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *site) meterConfig(name string) (meterConfig, bool) {
+	for _, mc := range s.conf.Meters {
+		if mc.Name == name {
+			return mc, true
+		}
+	}
+	return meterConfig{}, false
+}
+
+func (s *site) chargerConfig(name string) (chargerConfig, bool) {
+	for _, cc := range s.conf.Chargers {
+		if cc.Name == name {
+			return cc, true
+		}
+	}
+	return chargerConfig{}, false
+}
+
+func (s *site) vehicleConfig(name string) (vehicleConfig, bool) {
+	for _, vc := range s.conf.Vehicles {
+		if vc.Name == name {
+			return vc, true
+		}
+	}
+	return vehicleConfig{}, false
+}
+
+// close closes chargers of s not used by next anymore, all if next is nil
+func (s *site) close(next *site) {
+	for name, c := range s.chargers {
+		if next != nil && next.chargers[name] == c {
+			continue
+		}
+		if cl, ok := c.(io.Closer); ok {
+			if err := cl.Close(); err != nil {
+				log.Printf("%s: %v", name, err)
+			}
+		}
+	}
+}
+
+// newLoadPoint creates a loadpoint using the devices of s
+func newLoadPoint(s *site, lpc loadPointConfig) (*core.LoadPoint, error) {
+	charger, ok := s.chargers[lpc.Charger]
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid charger '%s'", lpc.Name, lpc.Charger)
+	}
+	lp := core.NewLoadPoint(
+		lpc.Name,
+		charger,
+	)
+
+	// assign meters
+	for _, m := range []struct {
+		key   string
+		meter *api.Meter
+	}{
+		{lpc.GridMeter, &lp.GridMeter},
+		{lpc.ChargeMeter, &lp.ChargeMeter},
+		{lpc.PVMeter, &lp.PVMeter},
+	} {
+		if m.key != "" {
+			if impl, ok := s.meters[m.key]; ok {
+				*m.meter = impl
+			} else {
+				return nil, fmt.Errorf("%s: invalid meter '%s'", lpc.Name, m.key)
+			}
+		}
+	}
+
+	// assign vehicle
+	if lpc.Vehicle != "" {
+		if impl, ok := s.vehicles[lpc.Vehicle]; ok {
+			lp.Vehicle = impl
+		} else {
+			return nil, fmt.Errorf("%s: invalid vehicle '%s'", lpc.Name, lpc.Vehicle)
+		}
+	}
+
+	// assign remaing config
+	lp.Tariffs = core.Tariffs{
+		Grid:     s.conf.Tariffs.Grid,
+		FeedIn:   s.conf.Tariffs.FeedIn,
+		Currency: s.conf.Tariffs.Currency,
+	}
+	lp.Tariff = s.tariff
+	lp.Intensity = s.intensity
+	lp.Forecast = s.forecast
+	lp.MaxExport = s.conf.MaxExport
+	lp.DryRun = s.conf.DryRun
+	if err := configureLoadPoint(lp, lpc); err != nil {
+		return nil, fmt.Errorf("%s: %v", lpc.Name, err)
+	}
+
+	return lp, nil
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"github.com/andig/evcc/api"
+)
+
+// chargerEnabled returns the charger's enabled state. In dry run, the state
+// intended by the loadpoint is returned once it tried to change it.
+func (lp *LoadPoint) chargerEnabled(charger api.Charger) (bool, error) {
+	lp.Lock()
+	if lp.DryRun && lp.dryRunValid {
+		defer lp.Unlock()
+		return lp.dryRunEnabled, nil
+	}
+	lp.Unlock()
+
+	return charger.Enabled()
+}
+
+// ChargerEnabled returns the charger's enabled state, or the intended state in
+// dry run. The charger read is not recorded.
+func (lp *LoadPoint) ChargerEnabled() (bool, error) {
+	return lp.chargerEnabled(Untraced(lp.Charger).(api.Charger))
+}
+
+// enableCharger enables or disables the charger. In dry run, the intended
+// state is logged and recorded instead.
+func (lp *LoadPoint) enableCharger(charger api.Charger, enable bool) error {
+	if !lp.DryRun {
+		return charger.Enable(enable)
+	}
+
+	Logger.Printf("%s dry run: charger enabled: %v", lp.Name, enable)
+
+	lp.Lock()
+	defer lp.Unlock()
+	lp.dryRunEnabled = enable
+	lp.dryRunValid = true
+
+	return nil
+}
+
+// setMaxCurrent sets the charger's max current. In dry run, the intended
+// current is logged instead.
+func (lp *LoadPoint) setMaxCurrent(current int64) error {
+	if lp.DryRun {
+		Logger.Printf("%s dry run: max charge current: %dA", lp.Name, current)
+		return nil
+	}
+
+	return lp.Charger.(api.ChargeController).MaxCurrent(current)
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"time"
+
+	"github.com/andig/evcc/api"
+)
+
+// SolarForecasting configures when minpv mode skips minimum charging because
+// the pv forecast is expected to cover the required energy
+type SolarForecasting struct {
+	Energy  float64       // Wh required per session
+	Horizon time.Duration // forecast look-ahead, e.g. 24h to wait for tomorrow's sun
+	Share   float64       // share of forecast production available for charging
+}
+
+// forecastEnergy returns the forecast energy in Wh between from and to
+func forecastEnergy(rates []api.Rate, from, to time.Time) float64 {
+	var energy float64
+	for _, r := range rates {
+		start, end := r.Start, r.End
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			energy += r.Value * end.Sub(start).Hours()
+		}
+	}
+	return energy
+}
+
+// Forecasting returns the pv forecast and its configuration for charging
+func (lp *LoadPoint) Forecasting() (api.Forecast, SolarForecasting) {
+	lp.devicesMux.RLock()
+	defer lp.devicesMux.RUnlock()
+
+	return lp.Forecast, lp.Solar
+}
+
+// ForecastEnergy returns the pv energy in Wh forecast to be available for
+// charging within the forecast horizon
+func (lp *LoadPoint) ForecastEnergy(ts time.Time) (float64, error) {
+	lp.devicesMux.RLock()
+	defer lp.devicesMux.RUnlock()
+
+	lp.Lock()
+	deadline := lp.solarDeadline
+	lp.Unlock()
+
+	if deadline.IsZero() {
+		deadline = ts.Add(lp.Solar.Horizon)
+	}
+
+	return lp.forecastEnergy(ts, deadline)
+}
+
+func (lp *LoadPoint) forecastEnergy(from, to time.Time) (float64, error) {
+	rates, err := lp.Forecast.Rates()
+	if err != nil {
+		return 0, err
+	}
+
+	return lp.Solar.Share * forecastEnergy(rates, from, to), nil
+}
+
+// solarSufficient checks if the session's remaining energy is expected to be
+// covered by pv surplus within the forecast horizon. The horizon starts with
+// the first check after the vehicle is connected, minimum charging is required
+// once it has passed or if no forecast is available.
+func (lp *LoadPoint) solarSufficient(ts time.Time) bool {
+	if lp.Forecast == nil || lp.Solar.Energy <= 0 {
+		return false
+	}
+
+	lp.Lock()
+	if lp.solarDeadline.IsZero() {
+		lp.solarDeadline = ts.Add(lp.Solar.Horizon)
+	}
+	deadline := lp.solarDeadline
+	remaining := lp.Solar.Energy - lp.chargeSolarEnergy - lp.chargeGridEnergy
+	lp.Unlock()
+
+	if !ts.Before(deadline) {
+		Logger.Printf("%s forecast horizon passed", lp.Name)
+		return false
+	}
+
+	forecast, err := lp.forecastEnergy(ts, deadline)
+	if err != nil {
+		Logger.Printf("%s forecast error: %v", lp.Name, err)
+		return false
+	}
+
+	Logger.Printf("%s forecast energy: %.0fWh, remaining: %.0fWh", lp.Name, forecast, remaining)
+
+	return forecast >= remaining
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"time"
+)
+
+// CleanCharging configures when clean mode charges from grid
+type CleanCharging struct {
+	CO2Limit  float64       // charge if CO2 intensity in g/kWh is at or below limit
+	Duration  time.Duration // charge during cleanest slots of total duration before departure
+	Departure time.Duration // time of day since midnight
+}
+
+// gridIntensity returns the grid CO2 intensity in g/kWh at ts or 0 if unknown
+func (lp *LoadPoint) gridIntensity(ts time.Time) float64 {
+	if lp.Intensity == nil {
+		return 0
+	}
+
+	rates, err := lp.Intensity.Rates()
+	if err != nil {
+		Logger.Printf("%s intensity error: %v", lp.Name, err)
+		return 0
+	}
+
+	if r, ok := currentRate(rates, ts); ok {
+		return r.Value
+	}
+
+	return 0
+}
+
+// clean checks if charging from grid is clean at ts. Contrary to cheap mode,
+// charging falls back to pv surplus if no forecast is available.
+func (lp *LoadPoint) clean(ts time.Time) bool {
+	rates, err := lp.Intensity.Rates()
+	if err != nil {
+		Logger.Printf("%s intensity error: %v", lp.Name, err)
+		return false
+	}
+
+	r, ok := currentRate(rates, ts)
+	if !ok {
+		Logger.Printf("%s no intensity available", lp.Name)
+		return false
+	}
+	Logger.Printf("%s grid intensity: %.0fg/kWh", lp.Name, r.Value)
+
+	return lp.planned(rates, r, ts, lp.Clean.CO2Limit, lp.Clean.Duration, lp.Clean.Departure)
+}
+
+// ChargeCO2 returns the session's CO2 emissions in g from grid energy
+func (lp *LoadPoint) ChargeCO2() float64 {
+	lp.Lock()
+	defer lp.Unlock()
+	return lp.chargeCO2
+}
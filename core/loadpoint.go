@@ -35,6 +35,21 @@ type LoadPoint struct {
 	MaxCurrent  int64
 	Voltage     float64
 	Phases      float64
+	TargetSoC   int64 // target state of charge in %
+	Vehicle     api.Vehicle
+	Sessions    SessionStore // charge session log
+	Tariffs     Tariffs      // energy prices for cost accounting
+	StateStore  StateStore   // persists state across restarts
+	Tariff      api.Tariff   // dynamic grid prices, overrides Tariffs.Grid
+	Cheap       CheapCharging
+	Intensity   api.Intensity // grid CO2 intensity forecast
+	Clean       CleanCharging
+	Forecast    api.Forecast // pv production forecast
+	Solar       SolarForecasting
+	Smoothing   Smoothing // pv surplus smoothing
+	MaxExport   float64   // W, site feed-in limit
+	Safe        SafeState // charger state on shutdown
+	DryRun      bool      // log charger changes instead of applying them
 
 	// state variables
 	isCharging        bool
@@ -42,6 +57,36 @@ type LoadPoint struct {
 	chargeStartTime   time.Time
 	chargedEnergy     float64
 	chargedDuration   time.Duration
+	chargeMaxCurrent  int64   // max actual current during session
+	chargeSolarEnergy float64 // session energy from pv surplus
+	chargeGridEnergy  float64 // session energy from grid
+	chargeCost        float64
+	chargeSavings     float64
+	chargeCO2         float64   // session CO2 emissions in g
+	accountedAt       time.Time // last accounting update
+	targetCurrent     int64     // last target current determined by charge mode
+	schedule          Schedule
+	scheduled         bool      // scheduled mode applied since schedule change
+	scheduleBoundary  time.Time // last schedule boundary applied
+	solarDeadline     time.Time // end of forecast horizon for connected vehicle
+	surplus           float64   // smoothed pv surplus
+	surplusValid      bool
+	safeDisabled      bool // charger disabled by shutdown, enabled again on start
+	dryRunEnabled     bool // charger state intended in dry run
+	dryRunValid       bool
+	recorder          *Recorder // records update cycles for replay
+	persistedAt       time.Time // last state saved
+
+	// api calls use devices and configuration under read lock, Reconfigure
+	// replaces them under write lock
+	devicesMux sync.RWMutex
+}
+
+// Tariffs are energy prices per kWh used for session cost accounting
+type Tariffs struct {
+	Grid     float64 // grid import price
+	FeedIn   float64 // feed-in compensation, lost when charging from pv surplus
+	Currency string
 }
 
 // NewLoadPoint creates a LoadPoint with sane defaults
@@ -52,22 +97,32 @@ func NewLoadPoint(name string, charger api.Charger) *LoadPoint {
 		Voltage:         230, // V
 		MinCurrent:      5,   // A
 		MaxCurrent:      16,  // A
+		TargetSoC:       100, // %
 		Mode:            api.ModeNow,
 		Charger:         charger,
+		Solar:           SolarForecasting{Horizon: 24 * time.Hour, Share: 1},
 		chargedDuration: 0,
 	}
 }
 
 // setTargetCurrent guards setting current against changing to identical value
-// and violating MaxCurrent
-func (lp *LoadPoint) setTargetCurrent(chargeCurrent, targetChargeCurrent int64) error {
-	if targetChargeCurrent > lp.MaxCurrent {
-		targetChargeCurrent = lp.MaxCurrent
+// and violating maxCurrent
+func (lp *LoadPoint) setTargetCurrent(chargeCurrent, targetChargeCurrent, maxCurrent int64) error {
+	if targetChargeCurrent > maxCurrent {
+		targetChargeCurrent = maxCurrent
 		Logger.Printf("%s limit charge current: %dA", lp.Name, targetChargeCurrent)
 	}
 
+	if targetChargeCurrent > 0 && lp.targetSoCReached() {
+		targetChargeCurrent = 0
+		Logger.Printf("%s target soc reached, charge current: 0A", lp.Name)
+	}
+
+	lp.setTarget(targetChargeCurrent)
+	lp.updateMaxCurrent(chargeCurrent)
+
 	if chargeCurrent != targetChargeCurrent {
-		if err := lp.Charger.(api.ChargeController).MaxCurrent(targetChargeCurrent); err != nil {
+		if err := lp.setMaxCurrent(targetChargeCurrent); err != nil {
 			return fmt.Errorf("charge controller error: %v", err)
 		}
 	}
@@ -75,17 +130,113 @@ func (lp *LoadPoint) setTargetCurrent(chargeCurrent, targetChargeCurrent int64)
 	return nil
 }
 
-// chargerEnable switches charger on/off if status
+// targetSoCReached checks the vehicle's state of charge against the target
+// if the vehicle reports it
+func (lp *LoadPoint) targetSoCReached() bool {
+	v, ok := lp.Vehicle.(api.ChargeState)
+	if !ok {
+		return false
+	}
+
+	soc, err := v.ChargeState()
+	if err != nil {
+		log.Printf("%s vehicle soc error: %v", lp.Name, err)
+		return false
+	}
+
+	return soc >= float64(lp.Settings().TargetSoC)
+}
+
+// setTarget stores target current for reporting
+func (lp *LoadPoint) setTarget(current int64) {
+	lp.Lock()
+	defer lp.Unlock()
+	lp.targetCurrent = current
+}
+
+// updateMaxCurrent tracks the session's max actual current
+func (lp *LoadPoint) updateMaxCurrent(current int64) {
+	lp.Lock()
+	defer lp.Unlock()
+	if lp.isCharging && current > lp.chargeMaxCurrent {
+		lp.chargeMaxCurrent = current
+	}
+}
+
+// updateAccounting integrates charged energy by source and its cost since the
+// last update. Charge power is covered by pv surplus first, the remainder is
+// taken from the grid.
+func (lp *LoadPoint) updateAccounting(gridPower, chargePower float64) {
+	price := lp.gridPrice(time.Now())
+	intensity := lp.gridIntensity(time.Now())
+
+	lp.Lock()
+	defer lp.Unlock()
+
+	if !lp.isCharging {
+		return
+	}
+
+	now := time.Now()
+	if !lp.accountedAt.IsZero() && chargePower > 0 {
+		hours := now.Sub(lp.accountedAt).Hours()
+
+		gridShare := math.Min(chargePower, math.Max(0, gridPower))
+		solarShare := chargePower - gridShare
+
+		lp.chargeGridEnergy += gridShare * hours
+		lp.chargeSolarEnergy += solarShare * hours
+		lp.chargeCost += (gridShare*price + solarShare*lp.Tariffs.FeedIn) * hours / 1e3
+		lp.chargeSavings += solarShare * (price - lp.Tariffs.FeedIn) * hours / 1e3
+		lp.chargeCO2 += gridShare * intensity * hours / 1e3
+	}
+	lp.accountedAt = now
+}
+
+// SolarPercentage returns the share of session energy charged from pv surplus
+func (lp *LoadPoint) SolarPercentage() float64 {
+	lp.Lock()
+	defer lp.Unlock()
+	return lp.solarPercentage()
+}
+
+func (lp *LoadPoint) solarPercentage() float64 {
+	total := lp.chargeSolarEnergy + lp.chargeGridEnergy
+	if total == 0 {
+		return 0
+	}
+	return 100 * lp.chargeSolarEnergy / total
+}
+
+// ChargeCost returns the session's energy cost and the savings compared to
+// charging from grid only
+func (lp *LoadPoint) ChargeCost() (cost, savings float64) {
+	lp.Lock()
+	defer lp.Unlock()
+	return lp.chargeCost, lp.chargeSavings
+}
+
+// TargetCurrent returns the last target current determined by the charge mode
+func (lp *LoadPoint) TargetCurrent() int64 {
+	lp.Lock()
+	defer lp.Unlock()
+	return lp.targetCurrent
+}
+
+// chargerEnable switches charger on/off if status. Used outside of update
+// cycles, charger access is not recorded.
 func (lp *LoadPoint) chargerEnable(enable bool) error {
+	charger := Untraced(lp.Charger).(api.Charger)
+
 	// get enabled state
-	enabled, err := lp.Charger.Enabled()
+	enabled, err := lp.chargerEnabled(charger)
 	if err != nil {
 		return err
 	}
 
 	// state change required?
 	if enable != enabled {
-		return lp.Charger.Enable(enable)
+		return lp.enableCharger(charger, enable)
 	}
 
 	return nil
@@ -99,13 +250,49 @@ func (lp *LoadPoint) CurrentChargeMode() api.ChargeMode {
 	return lp.Mode
 }
 
-// ChargeMode updates charge mode
+// ChargeMode updates charge mode. The charger is only switched if the mode is
+// valid for the loadpoint's devices. Waits for running reconfiguration.
 func (lp *LoadPoint) ChargeMode(mode api.ChargeMode) error {
-	Logger.Printf("%s set charge mode: %s", lp.Name, string(mode))
+	lp.devicesMux.RLock()
+	defer lp.devicesMux.RUnlock()
+
+	return lp.chargeMode(mode)
+}
+
+// chargeMode updates charge mode while devices are not replaced
+func (lp *LoadPoint) chargeMode(mode api.ChargeMode) error {
+	if !ValidMode(mode) {
+		return errors.New("invalid charge mode: " + string(mode))
+	}
 
 	// check if charger is controllable
 	_, chargerControllable := lp.Charger.(api.ChargeController)
 
+	// remaining modes require GridMeter
+	if mode == api.ModeMinPV || mode == api.ModePV {
+		if lp.GridMeter == nil || !chargerControllable {
+			return errors.New("invalid charge mode: " + string(mode))
+		}
+	}
+
+	// feed-in limit mode requires limit
+	if mode == api.ModeFeedInLimit && (lp.MaxExport <= 0 || lp.GridMeter == nil || !chargerControllable) {
+		return errors.New("invalid charge mode: " + string(mode))
+	}
+
+	// cheap mode requires tariff
+	if mode == api.ModeCheap && (lp.Tariff == nil || !chargerControllable) {
+		return errors.New("invalid charge mode: " + string(mode))
+	}
+
+	// clean mode requires intensity forecast and falls back to pv
+	if mode == api.ModeClean && (lp.Intensity == nil || lp.GridMeter == nil || !chargerControllable) {
+		return errors.New("invalid charge mode: " + string(mode))
+	}
+
+	defer lp.persist()
+	Logger.Printf("%s set charge mode: %s", lp.Name, string(mode))
+
 	// disable charger if enabled
 	if mode == api.ModeOff {
 		if err := lp.chargerEnable(false); err != nil {
@@ -117,7 +304,7 @@ func (lp *LoadPoint) ChargeMode(mode api.ChargeMode) error {
 		lp.Mode = mode
 
 		// async from http call
-		go lp.stopCharging()
+		lp.async(lp.stopCharging)
 
 		return nil
 	}
@@ -127,19 +314,119 @@ func (lp *LoadPoint) ChargeMode(mode api.ChargeMode) error {
 		return err
 	}
 
-	// remaining modes require GridMeter
-	if mode == api.ModeMinPV || mode == api.ModePV {
-		if lp.GridMeter == nil || !chargerControllable {
-			return errors.New("invalid charge mode: " + string(mode))
-		}
-	}
-
 	lp.Lock()
 	defer lp.Unlock()
 	lp.Mode = mode
 
 	// async from http call
-	go lp.startCharging()
+	lp.async(lp.startCharging)
+
+	return nil
+}
+
+// async runs fn in background while devices are not replaced
+func (lp *LoadPoint) async(fn func()) {
+	go func() {
+		lp.devicesMux.RLock()
+		defer lp.devicesMux.RUnlock()
+
+		fn()
+	}()
+}
+
+// Settings are the loadpoint's user-adjustable parameters
+type Settings struct {
+	Mode       api.ChargeMode `json:"mode"`
+	MinCurrent int64          `json:"minCurrent"`
+	MaxCurrent int64          `json:"maxCurrent"`
+	Phases     float64        `json:"phases"`
+	TargetSoC  int64          `json:"targetSoC"`
+}
+
+// Settings returns a consistent copy of the loadpoint's settings
+func (lp *LoadPoint) Settings() Settings {
+	lp.Lock()
+	defer lp.Unlock()
+
+	return Settings{
+		Mode:       lp.Mode,
+		MinCurrent: lp.MinCurrent,
+		MaxCurrent: lp.MaxCurrent,
+		Phases:     lp.Phases,
+		TargetSoC:  lp.TargetSoC,
+	}
+}
+
+// validCurrent checks current against the charger's supported range
+func (lp *LoadPoint) validCurrent(current int64) bool {
+	if l, ok := lp.Charger.(api.CurrentLimiter); ok {
+		min, max := l.CurrentLimits()
+		return current >= min && current <= max
+	}
+
+	return current > 0
+}
+
+// SetMinCurrent updates minimum charge current
+func (lp *LoadPoint) SetMinCurrent(current int64) error {
+	defer lp.persist()
+	lp.Lock()
+	defer lp.Unlock()
+
+	if !lp.validCurrent(current) || current > lp.MaxCurrent {
+		return fmt.Errorf("invalid min current: %dA", current)
+	}
+
+	Logger.Printf("%s set min current: %dA", lp.Name, current)
+	lp.MinCurrent = current
+
+	return nil
+}
+
+// SetMaxCurrent updates maximum charge current
+func (lp *LoadPoint) SetMaxCurrent(current int64) error {
+	defer lp.persist()
+	lp.Lock()
+	defer lp.Unlock()
+
+	if !lp.validCurrent(current) || current < lp.MinCurrent {
+		return fmt.Errorf("invalid max current: %dA", current)
+	}
+
+	Logger.Printf("%s set max current: %dA", lp.Name, current)
+	lp.MaxCurrent = current
+
+	return nil
+}
+
+// SetPhases updates number of phases used for power calculation
+func (lp *LoadPoint) SetPhases(phases int64) error {
+	defer lp.persist()
+	lp.Lock()
+	defer lp.Unlock()
+
+	if phases < 1 || phases > 3 {
+		return fmt.Errorf("invalid phases: %d", phases)
+	}
+
+	Logger.Printf("%s set phases: %d", lp.Name, phases)
+	lp.Phases = float64(phases)
+
+	return nil
+}
+
+// SetTargetSoC updates target state of charge
+func (lp *LoadPoint) SetTargetSoC(soc int64) error {
+	defer lp.persist()
+	lp.Lock()
+	defer lp.Unlock()
+
+	if soc <= 0 || soc > 100 {
+		return fmt.Errorf("invalid target soc: %d%%", soc)
+	}
+
+	Logger.Printf("%s set target soc: %d%%", lp.Name, soc)
+	lp.TargetSoC = soc
 
 	return nil
 }
@@ -154,8 +441,17 @@ func (lp *LoadPoint) startCharging() {
 	lp.isCharging = true
 	lp.chargeStartTime = time.Now()
 	lp.chargeStartEnergy = 0
+	lp.chargeMaxCurrent = 0
+	lp.chargeSolarEnergy = 0
+	lp.chargeGridEnergy = 0
+	lp.chargeCost = 0
+	lp.chargeSavings = 0
+	lp.chargeCO2 = 0
+	lp.accountedAt = time.Time{}
 	lp.Unlock()
 
+	defer lp.persist()
+
 	// get starting energy amount
 	if m, ok := lp.ChargeMeter.(api.MeterEnergy); ok {
 		if f, err := m.TotalEnergy(); err == nil {
@@ -177,19 +473,61 @@ func (lp *LoadPoint) stopCharging() {
 	}
 	lp.isCharging = false
 	lp.chargedDuration = time.Now().Sub(lp.chargeStartTime)
+	lp.surplusValid = false
 	lp.Unlock()
 
+	defer lp.persist()
+
 	// get end energy amount
-	if m, ok := lp.ChargeMeter.(api.MeterEnergy); ok {
+	m, measurable := lp.ChargeMeter.(api.MeterEnergy)
+	if measurable {
 		if f, err := m.TotalEnergy(); err == nil {
 			lp.Lock()
-			defer lp.Unlock()
 			lp.chargedEnergy = f - lp.chargeStartEnergy
 			Logger.Printf("%s charged energy final: %.0f", lp.Name, lp.chargedEnergy)
+			lp.Unlock()
 		} else {
 			Logger.Printf("%s charge meter error: %s", lp.Name, err)
 		}
 	}
+
+	lp.addSession(measurable)
+}
+
+// addSession records the finished charge session. Sessions without charged
+// energy are skipped if energy is measurable.
+func (lp *LoadPoint) addSession(measurable bool) {
+	if lp.Sessions == nil {
+		return
+	}
+
+	lp.Lock()
+	session := Session{
+		LoadPoint:  lp.Name,
+		Start:      lp.chargeStartTime,
+		End:        lp.chargeStartTime.Add(lp.chargedDuration),
+		Energy:     lp.chargedEnergy,
+		MaxCurrent: lp.chargeMaxCurrent,
+
+		SolarPercentage: lp.solarPercentage(),
+		Cost:            lp.chargeCost,
+		Savings:         lp.chargeSavings,
+		Currency:        lp.Tariffs.Currency,
+		CO2:             lp.chargeCO2,
+	}
+	lp.Unlock()
+
+	if measurable && session.Energy <= 0 {
+		return
+	}
+
+	if lp.Vehicle != nil {
+		session.Vehicle = lp.Vehicle.Title()
+	}
+
+	if err := lp.Sessions.AddSession(session); err != nil {
+		Logger.Printf("%s session error: %v", lp.Name, err)
+	}
 }
 
 // ChargeDuration returns for how long the charge cycle has been running
@@ -219,8 +557,8 @@ func (lp *LoadPoint) ChargedEnergy() (float64, error) {
 	}
 	lp.Unlock()
 
-	// get starting energy amount
-	if m, ok := lp.ChargeMeter.(api.MeterEnergy); ok {
+	// get starting energy amount, not recorded
+	if m, ok := Untraced(lp.ChargeMeter).(api.MeterEnergy); ok {
 		if f, err := m.TotalEnergy(); err == nil {
 			lp.Lock()
 			defer lp.Unlock()
@@ -239,20 +577,40 @@ func (lp *LoadPoint) ChargedEnergy() (float64, error) {
 // updateChargerEnabled checks charger enabled state
 func (lp *LoadPoint) updateChargerEnabled() (bool, api.ChargeMode) {
 	// check charger status
-	enabled, err := lp.Charger.Enabled()
+	enabled, err := lp.chargerEnabled(lp.Charger)
 	if err != nil {
 		log.Printf("%s charger error: %v", lp.Name, err)
 		return false, api.ModeOff
 	}
 	Logger.Printf("%s charger enabled: %v", lp.Name, enabled)
 
+	// charger disabled by shutdown keeps the persisted mode
+	lp.Lock()
+	safeDisabled, mode := lp.safeDisabled, lp.Mode
+	lp.safeDisabled = false
+	lp.Unlock()
+
+	if !enabled && safeDisabled && mode != api.ModeOff {
+		Logger.Printf("%s enable charger disabled by shutdown", lp.Name)
+		if err := lp.enableCharger(lp.Charger, true); err != nil {
+			log.Printf("%s charger error: %v", lp.Name, err)
+		} else {
+			enabled = true
+		}
+	}
+
 	// set mode=off if charger not enabled
 	if !enabled {
 		lp.stopCharging()
 
 		lp.Lock()
+		changed := lp.Mode != api.ModeOff
 		lp.Mode = api.ModeOff
 		lp.Unlock()
+
+		if changed {
+			lp.persist()
+		}
 	}
 
 	lp.Lock()
@@ -270,9 +628,14 @@ func (lp *LoadPoint) updateCarConnected() bool {
 	}
 	Logger.Printf("%s charger status: %s", lp.Name, status)
 
-	connected := status == api.StatusC
+	// vehicle remains connected while charging is paused
+	connected := status == api.StatusB || status == api.StatusC || status == api.StatusD
 	if !connected {
 		lp.stopCharging()
+
+		lp.Lock()
+		lp.solarDeadline = time.Time{}
+		lp.Unlock()
 	}
 
 	return connected
@@ -280,15 +643,30 @@ func (lp *LoadPoint) updateCarConnected() bool {
 
 // Update reevaluates meters and charger state
 func (lp *LoadPoint) Update() {
+	// mark update cycle in recorded trace
+	if lp.recorder != nil {
+		lp.recorder.record(lp.Name, "loadpoint", opUpdate, lp.Settings(), nil)
+		defer lp.recorder.record(lp.Name, "loadpoint", opUpdated, nil, nil)
+	}
+
+	// keep charger from falling back to failsafe current, not armed in dry run
+	if hb, ok := lp.Charger.(api.Heartbeat); ok && !lp.DryRun {
+		if err := hb.Heartbeat(); err != nil {
+			log.Printf("%s charger heartbeat error: %v", lp.Name, err)
+		}
+	}
+
 	// check if charging is enabled
 	enabled, mode := lp.updateChargerEnabled()
 	Logger.Printf("%s charge mode: %s", lp.Name, mode)
 	if !enabled || mode == api.ModeOff {
+		lp.setTarget(0)
 		return
 	}
 
 	// check if car is connected
 	if connected := lp.updateCarConnected(); !connected {
+		lp.setTarget(0)
 		return
 	}
 
@@ -306,10 +684,17 @@ func (lp *LoadPoint) Update() {
 	switch mode {
 	case api.ModeNow:
 		err = lp.ApplyModeNow()
-	case api.ModeMinPV, api.ModePV:
+	case api.ModeMinPV, api.ModePV, api.ModeFeedInLimit:
 		err = lp.ApplyModePV(mode)
+	case api.ModeCheap:
+		err = lp.ApplyModeCheap()
+	case api.ModeClean:
+		err = lp.ApplyModeClean()
 	}
 
+	// save session accounting
+	lp.persistSession()
+
 	if err != nil {
 		Logger.Printf("%s error: %v", lp.Name, err)
 		return
@@ -318,9 +703,41 @@ func (lp *LoadPoint) Update() {
 
 // ApplyModeNow sets "now" charger mode
 func (lp *LoadPoint) ApplyModeNow() error {
+	settings := lp.Settings()
+	return lp.applyCurrent(settings, settings.MaxCurrent)
+}
+
+// ApplyModeCheap sets "cheap" charge mode. Charging from grid is limited to
+// cheap time slots.
+func (lp *LoadPoint) ApplyModeCheap() error {
+	settings := lp.Settings()
+
+	var targetChargeCurrent int64
+	if lp.cheap(time.Now()) {
+		targetChargeCurrent = settings.MaxCurrent
+	}
+
+	return lp.applyCurrent(settings, targetChargeCurrent)
+}
+
+// ApplyModeClean sets "clean" charge mode. Charging from grid is limited to
+// time slots of low CO2 intensity, pv surplus is used otherwise.
+func (lp *LoadPoint) ApplyModeClean() error {
+	if lp.clean(time.Now()) {
+		settings := lp.Settings()
+		return lp.applyCurrent(settings, settings.MaxCurrent)
+	}
+
+	return lp.ApplyModePV(api.ModePV)
+}
+
+// applyCurrent sets target current independent of pv surplus
+func (lp *LoadPoint) applyCurrent(settings Settings, targetChargeCurrent int64) error {
 	// get grid power
+	var gridPower float64
 	if lp.GridMeter != nil {
-		gridPower, err := lp.GridMeter.CurrentPower()
+		var err error
+		gridPower, err = lp.GridMeter.CurrentPower()
 		if err != nil {
 			log.Printf("%s meter error: %v", lp.Name, err)
 			return err
@@ -336,20 +753,29 @@ func (lp *LoadPoint) ApplyModeNow() error {
 	}
 	Logger.Printf("%s charge current: %dA", lp.Name, chargeCurrent)
 
-	// get max charge current
-	targetChargeCurrent := lp.MaxCurrent
+	// energy source is unknown without grid meter
+	if lp.GridMeter != nil {
+		chargePower := CurrentToPower(float64(chargeCurrent), lp.Voltage, settings.Phases)
+		lp.updateAccounting(gridPower, chargePower)
+	}
+
 	Logger.Printf("%s max charge current: %dA", lp.Name, targetChargeCurrent)
 
 	// set max charge current
-	if err := lp.setTargetCurrent(chargeCurrent, targetChargeCurrent); err != nil {
+	if err := lp.setTargetCurrent(chargeCurrent, targetChargeCurrent, settings.MaxCurrent); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// ApplyModePV sets "minpv" or "pv" load modes
+// ApplyModePV sets "minpv", "pv" or "feedinlimit" load modes. In feed-in limit
+// mode only surplus exceeding the export limit is used. Curtailed pv is not
+// visible at the grid meter, hence charge power is increased by one ampere per
+// cycle while exporting at the limit.
 func (lp *LoadPoint) ApplyModePV(mode api.ChargeMode) error {
+	settings := lp.Settings()
+
 	// get grid power
 	gridPower, err := lp.GridMeter.CurrentPower()
 	if err != nil {
@@ -367,28 +793,52 @@ func (lp *LoadPoint) ApplyModePV(mode api.ChargeMode) error {
 	Logger.Printf("%s charge current: %dA", lp.Name, chargeCurrent)
 
 	// get charge power
-	chargePower := CurrentToPower(float64(chargeCurrent), lp.Voltage, lp.Phases)
+	chargePower := CurrentToPower(float64(chargeCurrent), lp.Voltage, settings.Phases)
 	Logger.Printf("%s charge power: %.0fW", lp.Name, chargePower)
 
+	lp.updateAccounting(gridPower, chargePower)
+
 	// -2500w = -1500w - 1000w
 	haNetPower := gridPower - chargePower
 	Logger.Printf("%s home power: %.0fW", lp.Name, haNetPower)
 
 	// maxChargePower = 2500w
-	maxChargePower := -haNetPower
-	Logger.Printf("%s max charge power: %.0fW", lp.Name, maxChargePower)
+	maxChargePower := lp.smoothSurplus(-haNetPower)
+	Logger.Printf("%s max charge power: %.0fW (actual %.0fW)", lp.Name, maxChargePower, -haNetPower)
+
+	var exportLimited bool // exporting at or near the feed-in limit
+	if mode == api.ModeFeedInLimit {
+		maxChargePower -= lp.MaxExport - CurrentToPower(1, lp.Voltage, settings.Phases)
+		exportLimited = maxChargePower >= 0
+		Logger.Printf("%s max charge power above export limit: %.0fW", lp.Name, maxChargePower)
+	}
 
 	// get max charge current
-	f := PowerToCurrent(maxChargePower, lp.Voltage, lp.Phases)
+	f := PowerToCurrent(maxChargePower, lp.Voltage, settings.Phases)
 	targetChargeCurrent := int64(math.Max(0, f))
 	Logger.Printf("%s max charge current: %dA", lp.Name, targetChargeCurrent)
 
-	if targetChargeCurrent < lp.MinCurrent {
+	// skip minimum charging if pv is expected to charge the vehicle in time
+	if mode == api.ModeMinPV && lp.solarSufficient(time.Now()) {
+		Logger.Printf("%s pv forecast sufficient", lp.Name)
+		mode = api.ModePV
+	}
+
+	if targetChargeCurrent < settings.MinCurrent {
 		switch mode {
 		case api.ModeMinPV:
-			targetChargeCurrent = lp.MinCurrent
-			minPower := CurrentToPower(float64(targetChargeCurrent), lp.Voltage, lp.Phases)
+			targetChargeCurrent = settings.MinCurrent
+			minPower := CurrentToPower(float64(targetChargeCurrent), lp.Voltage, settings.Phases)
 			Logger.Printf("%s override charge power: %.0fW", lp.Name, minPower)
+		case api.ModeFeedInLimit:
+			// pv may be curtailed, start charging to make it visible
+			if exportLimited && chargeCurrent == 0 {
+				targetChargeCurrent = settings.MinCurrent
+				Logger.Printf("%s export limit reached, start charging", lp.Name)
+			} else {
+				targetChargeCurrent = 0
+				Logger.Printf("%s override charge power: 0W", lp.Name)
+			}
 		case api.ModePV:
 			targetChargeCurrent = 0
 			Logger.Printf("%s override charge power: 0W", lp.Name)
@@ -397,7 +847,7 @@ func (lp *LoadPoint) ApplyModePV(mode api.ChargeMode) error {
 	}
 
 	// set max charge current
-	if err := lp.setTargetCurrent(chargeCurrent, targetChargeCurrent); err != nil {
+	if err := lp.setTargetCurrent(chargeCurrent, targetChargeCurrent, settings.MaxCurrent); err != nil {
 		return err
 	}
 
@@ -1,7 +1,10 @@
 package core
 
 import (
+	"math"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/andig/evcc/api"
 	"github.com/andig/evcc/api/mock_api"
@@ -41,7 +44,7 @@ func mockedLP(ctrl *gomock.Controller, tc testCase) *LoadPoint {
 	cc := mock_api.NewMockChargeController(ctrl)
 	if expectedCurrent, ok := tc.ExpectedCurrent.(int); ok {
 		cc.EXPECT().
-			MaxCurrent(gomock.Eq(expectedCurrent)).
+			MaxCurrent(gomock.Eq(int64(expectedCurrent))).
 			Return(nil)
 	}
 
@@ -93,7 +96,7 @@ func TestChargerEnableChange(t *testing.T) {
 		Return(nil)
 
 	lp := NewLoadPoint("lp1", c)
-	if err := lp.chargerEnable(false); err != nil {
+	if err := lp.chargerEnable(true); err != nil {
 		t.Error(err)
 	}
 }
@@ -103,6 +106,9 @@ func TestEVNotConnected(t *testing.T) {
 	defer ctrl.Finish()
 
 	c := mock_api.NewMockCharger(ctrl)
+	c.EXPECT().
+		Enabled().
+		Return(true, nil)
 	c.EXPECT().
 		Status().
 		Return(api.StatusA, nil)
@@ -117,9 +123,6 @@ func TestEVConnectedButDisabled(t *testing.T) {
 	defer ctrl.Finish()
 
 	c := mock_api.NewMockCharger(ctrl)
-	c.EXPECT().
-		Status().
-		Return(api.StatusC, nil)
 	c.EXPECT().
 		Enabled().
 		Return(false, nil)
@@ -181,3 +184,793 @@ func TestEVConnectedAndEnabledPVMode(t *testing.T) {
 		ctrl.Finish()
 	}
 }
+
+func TestEVConnectedAndEnabledFeedInLimitMode(t *testing.T) {
+	cases := []testCase{
+		testCase{api.ModeFeedInLimit, 0, 0, 0, 0.0, nil},
+		testCase{api.ModeFeedInLimit, 0, 0, 5, -1150.0, 0},   // below limit
+		testCase{api.ModeFeedInLimit, 0, 0, 10, -1150.0, 6},  // 1380W above limit - 1A
+		testCase{api.ModeFeedInLimit, 0, 0, 10, -2300.0, 11}, // curtailed, increase by 1A
+		testCase{api.ModeFeedInLimit, 0, 0, 0, -2300.0, 5},   // curtailed, start at min current
+	}
+
+	for _, c := range cases {
+		ctrl := gomock.NewController(t)
+
+		lp := mockedLP(ctrl, c)
+		lp.MaxExport = 2300
+		lp.Update()
+
+		ctrl.Finish()
+	}
+}
+
+type testSessions struct {
+	sessions []Session
+}
+
+func (s *testSessions) AddSession(session Session) error {
+	s.sessions = append(s.sessions, session)
+	return nil
+}
+
+func (s *testSessions) Sessions(filter SessionFilter) ([]Session, error) {
+	return s.sessions, nil
+}
+
+type testMeter struct {
+	power, energy float64
+}
+
+func (m *testMeter) CurrentPower() (float64, error) {
+	return m.power, nil
+}
+
+func (m *testMeter) TotalEnergy() (float64, error) {
+	return m.energy, nil
+}
+
+func TestSessionLog(t *testing.T) {
+	store := &testSessions{}
+	meter := &testMeter{energy: 1000}
+
+	var c api.Charger
+	lp := NewLoadPoint("lp1", c)
+	lp.ChargeMeter = meter
+	lp.Vehicle = NewVehicle("Zoe", 41)
+	lp.Sessions = store
+
+	// no energy charged
+	lp.startCharging()
+	lp.stopCharging()
+	if len(store.sessions) != 0 {
+		t.Errorf("expected no session, got %+v", store.sessions)
+	}
+
+	lp.startCharging()
+	lp.updateMaxCurrent(16)
+	meter.energy = 3500
+	lp.stopCharging()
+
+	if len(store.sessions) != 1 {
+		t.Fatalf("expected single session, got %+v", store.sessions)
+	}
+
+	s := store.sessions[0]
+	if s.LoadPoint != "lp1" || s.Vehicle != "Zoe" || s.Energy != 2500 || s.MaxCurrent != 16 || s.End.Before(s.Start) {
+		t.Errorf("unexpected session %+v", s)
+	}
+}
+
+// statusCharger reports given status
+type statusCharger struct {
+	api.Charger
+	status api.ChargeStatus
+}
+
+func (c *statusCharger) Status() (api.ChargeStatus, error) {
+	return c.status, nil
+}
+
+func TestPausedSession(t *testing.T) {
+	sessions := &testSessions{}
+	meter := &testMeter{energy: 1000}
+	charger := &statusCharger{status: api.StatusC}
+
+	lp := NewLoadPoint("lp1", charger)
+	lp.ChargeMeter = meter
+	lp.Sessions = sessions
+	lp.startCharging()
+
+	// paused by zero current or by the vehicle
+	for _, status := range []api.ChargeStatus{api.StatusB, api.StatusD, api.StatusC} {
+		charger.status = status
+		if !lp.updateCarConnected() {
+			t.Errorf("%s: expected vehicle to be connected", status)
+		}
+	}
+	if len(sessions.sessions) != 0 {
+		t.Errorf("expected session to continue, got %+v", sessions.sessions)
+	}
+
+	// unplugged
+	meter.energy = 3000
+	charger.status = api.StatusA
+	if lp.updateCarConnected() {
+		t.Error("expected vehicle to be disconnected")
+	}
+	if len(sessions.sessions) != 1 || sessions.sessions[0].Energy != 2000 {
+		t.Errorf("expected session to end, got %+v", sessions.sessions)
+	}
+}
+
+func TestAccounting(t *testing.T) {
+	var c api.Charger
+	lp := NewLoadPoint("lp1", c)
+	lp.Tariffs = Tariffs{Grid: 0.3, FeedIn: 0.08}
+
+	lp.startCharging()
+
+	// first update starts integration
+	lp.updateAccounting(1000, 3000)
+	if p := lp.SolarPercentage(); p != 0 {
+		t.Errorf("expected 0%%, got %.0f%%", p)
+	}
+
+	// 1h at 3kW, 1kW from grid
+	lp.accountedAt = lp.accountedAt.Add(-time.Hour)
+	lp.updateAccounting(1000, 3000)
+
+	if p := lp.SolarPercentage(); math.Abs(p-66.67) > 0.01 {
+		t.Errorf("expected 66.67%%, got %.2f%%", p)
+	}
+
+	cost, savings := lp.ChargeCost()
+	if math.Abs(cost-0.46) > 1e-3 || math.Abs(savings-0.44) > 1e-3 {
+		t.Errorf("unexpected cost %.3f and savings %.3f", cost, savings)
+	}
+
+	// exporting while charging
+	lp.accountedAt = lp.accountedAt.Add(-time.Hour)
+	lp.updateAccounting(-500, 3000)
+	if p := lp.SolarPercentage(); math.Abs(p-83.33) > 0.01 {
+		t.Errorf("expected 83.33%%, got %.2f%%", p)
+	}
+}
+
+type testStates map[string]State
+
+func (s testStates) SaveState(loadPoint string, state State) error {
+	s[loadPoint] = state
+	return nil
+}
+
+func (s testStates) LoadState(loadPoint string) (*State, error) {
+	if state, ok := s[loadPoint]; ok {
+		return &state, nil
+	}
+	return nil, nil
+}
+
+func TestRestoreState(t *testing.T) {
+	states := testStates{}
+	meter := &testMeter{energy: 1000}
+
+	var c api.Charger
+	lp := NewLoadPoint("lp1", c)
+	lp.ChargeMeter = meter
+	lp.StateStore = states
+
+	if err := lp.SetTargetSoC(80); err != nil {
+		t.Fatal(err)
+	}
+	schedule := Schedule{Entries: []ScheduleEntry{{From: "22:00", To: "06:00", Mode: api.ModeNow}}}
+	if err := lp.SetSchedule(schedule); err != nil {
+		t.Fatal(err)
+	}
+	lp.startCharging()
+
+	// restart
+	state, _ := states.LoadState("lp1")
+	if state == nil || state.TargetSoC != 80 || state.Session == nil || state.Session.StartEnergy != 1000 {
+		t.Fatalf("unexpected state %+v", state)
+	}
+
+	sessions := &testSessions{}
+	lp = NewLoadPoint("lp1", c)
+	lp.ChargeMeter = meter
+	lp.Sessions = sessions
+	lp.Restore(*state)
+
+	if s := lp.Settings(); s.TargetSoC != 80 {
+		t.Errorf("unexpected settings %+v", s)
+	}
+	if s := lp.Schedule(); !reflect.DeepEqual(s, schedule) {
+		t.Errorf("unexpected schedule %+v", s)
+	}
+
+	// session continues
+	meter.energy = 3000
+	lp.startCharging()
+	lp.stopCharging()
+
+	if len(sessions.sessions) != 1 || sessions.sessions[0].Energy != 2000 {
+		t.Errorf("unexpected sessions %+v", sessions.sessions)
+	}
+}
+
+// countingStates counts saved states
+type countingStates struct {
+	testStates
+	saved int
+}
+
+func (s *countingStates) SaveState(loadPoint string, state State) error {
+	s.saved++
+	return s.testStates.SaveState(loadPoint, state)
+}
+
+func TestPersistThrottled(t *testing.T) {
+	states := &countingStates{testStates: testStates{}}
+
+	lp := NewLoadPoint("lp1", &stubCharger{})
+	lp.StateStore = states
+
+	// session start is saved immediately
+	lp.Update()
+	if states.saved != 1 {
+		t.Fatalf("expected session start to be saved, got %d saves", states.saved)
+	}
+
+	// accounting is saved once per interval
+	lp.Update()
+	lp.Update()
+	if states.saved != 1 {
+		t.Errorf("expected no saves within interval, got %d", states.saved)
+	}
+
+	lp.persistedAt = lp.persistedAt.Add(-persistInterval)
+	lp.Update()
+	if states.saved != 2 {
+		t.Errorf("expected accounting to be saved after interval, got %d saves", states.saved)
+	}
+
+	// settings are saved immediately
+	if err := lp.SetMaxCurrent(10); err != nil {
+		t.Fatal(err)
+	}
+	if states.saved != 3 {
+		t.Errorf("expected settings to be saved, got %d saves", states.saved)
+	}
+}
+
+type testTariff []api.Rate
+
+func (t testTariff) Rates() ([]api.Rate, error) {
+	return t, nil
+}
+
+func TestCheap(t *testing.T) {
+	midnight := time.Date(2019, 10, 24, 0, 0, 0, 0, time.Local)
+
+	// hourly prices for 2 days, cheapest at 2:00 and 3:00
+	var tariff testTariff
+	for h := 0; h < 48; h++ {
+		price := 0.3
+		switch h % 24 {
+		case 2:
+			price = 0.1
+		case 3:
+			price = 0.15
+		case 4:
+			price = 0.2
+		}
+
+		start := midnight.Add(time.Duration(h) * time.Hour)
+		tariff = append(tariff, api.Rate{Start: start, End: start.Add(time.Hour), Value: price})
+	}
+
+	var c api.Charger
+	lp := NewLoadPoint("lp1", c)
+	lp.Tariff = tariff
+	lp.Cheap = CheapCharging{Duration: 2 * time.Hour, Departure: 7 * time.Hour}
+
+	// vehicle connected before midnight
+	lp.isCharging = true
+	lp.chargeStartTime = midnight.Add(-2 * time.Hour)
+
+	cases := []struct {
+		hour  float64
+		cheap bool
+	}{
+		{1, false},
+		{2.5, true},
+		{3, true},
+		{4, false},
+		{22, false},
+		{26, true}, // next day
+	}
+
+	for _, c := range cases {
+		ts := midnight.Add(time.Duration(c.hour * float64(time.Hour)))
+		if cheap := lp.cheap(ts); cheap != c.cheap {
+			t.Errorf("%.1fh: expected %v, got %v", c.hour, c.cheap, cheap)
+		}
+	}
+
+	// vehicle connected after cheapest slots
+	lp.chargeStartTime = midnight.Add(4 * time.Hour)
+	if !lp.cheap(midnight.Add(4 * time.Hour)) {
+		t.Error("expected charging in cheapest remaining slots")
+	}
+	if lp.cheap(midnight.Add(6 * time.Hour)) {
+		t.Error("expected no charging after planned slots")
+	}
+	lp.isCharging = false
+
+	// price limit
+	lp.Cheap = CheapCharging{PriceLimit: 0.2}
+	if !lp.cheap(midnight.Add(4*time.Hour)) || lp.cheap(midnight.Add(5*time.Hour)) {
+		t.Error("expected charging below price limit only")
+	}
+
+	// dynamic price used for accounting
+	if p := lp.gridPrice(midnight.Add(2 * time.Hour)); p != 0.1 {
+		t.Errorf("expected grid price 0.1, got %.2f", p)
+	}
+
+	// departure on daylight saving time change
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, day := range []int{29, 30} {
+		ts := time.Date(2020, 3, day-1, 23, 0, 0, 0, loc)
+		if next := nextDeparture(ts, 7*time.Hour); next.Day() != day || next.Hour() != 7 || next.Minute() != 0 {
+			t.Errorf("expected departure at 7:00, got %v", next)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	now := time.Now()
+	hour := now.Truncate(time.Hour)
+
+	// hourly intensity around now, cleanest in the next hour
+	intensity := testTariff{
+		{Start: hour.Add(-time.Hour), End: hour, Value: 300},
+		{Start: hour, End: hour.Add(time.Hour), Value: 400},
+		{Start: hour.Add(time.Hour), End: hour.Add(2 * time.Hour), Value: 150},
+	}
+
+	var c api.Charger
+	lp := NewLoadPoint("lp1", c)
+	lp.Intensity = intensity
+	lp.Clean = CleanCharging{CO2Limit: 200}
+
+	if lp.clean(now) || !lp.clean(hour.Add(90*time.Minute)) {
+		t.Error("expected charging below CO2 limit only")
+	}
+
+	// no forecast falls back to pv
+	if lp.clean(hour.Add(3 * time.Hour)) {
+		t.Error("expected no grid charging without forecast")
+	}
+
+	// 1h at 3kW, 1kW from grid at 400g/kWh
+	lp.Intensity = testTariff{{Start: now.Add(-time.Hour), End: now.Add(time.Hour), Value: 400}}
+	lp.startCharging()
+	lp.updateAccounting(1000, 3000)
+	lp.accountedAt = lp.accountedAt.Add(-time.Hour)
+	lp.updateAccounting(1000, 3000)
+
+	if co2 := lp.ChargeCO2(); math.Abs(co2-400) > 1 {
+		t.Errorf("expected 400g, got %.0fg", co2)
+	}
+}
+
+func TestSolarForecast(t *testing.T) {
+	now := time.Now()
+
+	// 2kW during 3 hours tomorrow morning
+	tomorrow := now.Add(12 * time.Hour)
+	forecast := testTariff{
+		{Start: now.Add(-time.Hour), End: now.Add(time.Hour), Value: 0},
+		{Start: tomorrow, End: tomorrow.Add(3 * time.Hour), Value: 2000},
+	}
+
+	var c api.Charger
+	lp := NewLoadPoint("lp1", c)
+	if lp.solarSufficient(now) {
+		t.Error("expected minimum charging without forecast")
+	}
+
+	lp.Forecast = forecast
+	lp.Solar.Energy = 5000
+	if !lp.solarSufficient(now) {
+		t.Error("expected forecast to cover required energy")
+	}
+
+	// only half of production available for charging
+	lp.Solar.Share = 0.5
+	if e, _ := lp.ForecastEnergy(now); math.Abs(e-3000) > 1e-6 {
+		t.Errorf("expected 3000Wh, got %.0fWh", e)
+	}
+	if lp.solarSufficient(now) {
+		t.Error("expected minimum charging")
+	}
+
+	// energy charged so far counts
+	lp.isCharging = true
+	lp.chargeGridEnergy = 2500
+	if !lp.solarSufficient(now) {
+		t.Error("expected forecast to cover remaining energy")
+	}
+
+	// horizon starts when the vehicle is connected
+	if !lp.solarSufficient(now.Add(6*time.Hour)) || lp.solarSufficient(now.Add(25*time.Hour)) {
+		t.Error("expected minimum charging after horizon only")
+	}
+
+	// forecast beyond horizon is ignored
+	lp.Charger = &statusCharger{status: api.StatusA}
+	lp.updateCarConnected()
+	lp.Solar.Horizon = 6 * time.Hour
+	if lp.solarSufficient(now) {
+		t.Error("expected minimum charging")
+	}
+}
+
+// stubCharger is an enabled and controllable charger
+type stubCharger struct{}
+
+func (c *stubCharger) Status() (api.ChargeStatus, error) { return api.StatusB, nil }
+func (c *stubCharger) Enabled() (bool, error)            { return true, nil }
+func (c *stubCharger) Enable(enable bool) error          { return nil }
+func (c *stubCharger) ActualCurrent() (int64, error)     { return 0, nil }
+func (c *stubCharger) MaxCurrent(current int64) error    { return nil }
+
+func TestSchedule(t *testing.T) {
+	schedule := Schedule{
+		Mode: api.ModePV,
+		Entries: []ScheduleEntry{
+			{Days: []string{"mon", "tue", "wed", "thu", "fri"}, From: "22:00", To: "06:00", Mode: api.ModeNow},
+		},
+	}
+
+	for _, s := range []Schedule{
+		{Mode: "fast"},
+		{Entries: []ScheduleEntry{{From: "22:00", To: "22:00", Mode: api.ModeNow}}},
+		{Entries: []ScheduleEntry{{Days: []string{"monday"}, From: "22:00", To: "06:00", Mode: api.ModeNow}}},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("%+v: expected error", s)
+		}
+	}
+
+	lp := NewLoadPoint("lp1", &stubCharger{})
+	lp.GridMeter = &testMeter{}
+	if err := lp.SetSchedule(schedule); err != nil {
+		t.Fatal(err)
+	}
+
+	monday := time.Date(2019, 10, 21, 0, 0, 0, 0, time.Local)
+	at := func(day int, hour float64) time.Time {
+		return monday.AddDate(0, 0, day).Add(time.Duration(hour * float64(time.Hour)))
+	}
+
+	scheduler := NewScheduler([]*LoadPoint{lp})
+
+	cases := []struct {
+		ts     time.Time
+		manual api.ChargeMode
+		mode   api.ChargeMode
+	}{
+		{at(0, 12), "", api.ModePV},
+		{at(0, 13), api.ModeOff, api.ModeOff}, // manual override
+		{at(0, 21), "", api.ModeOff},
+		{at(0, 22.5), "", api.ModeNow}, // boundary passed
+		{at(1, 5), "", api.ModeNow},
+		{at(1, 6), "", api.ModePV},
+		{at(5, 5), "", api.ModeNow}, // friday night
+		{at(5, 23), "", api.ModePV}, // weekend
+	}
+
+	for _, c := range cases {
+		if c.manual != "" {
+			if err := lp.ChargeMode(c.manual); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		scheduler.Update(c.ts)
+		if mode := lp.CurrentChargeMode(); mode != c.mode {
+			t.Errorf("%v: expected %s, got %s", c.ts, c.mode, mode)
+		}
+	}
+
+	// manual mode is kept after restart until the next boundary
+	scheduler.Update(at(7, 12))
+	if err := lp.ChargeMode(api.ModeOff); err != nil {
+		t.Fatal(err)
+	}
+	state := lp.State()
+
+	lp = NewLoadPoint("lp1", &stubCharger{})
+	lp.GridMeter = &testMeter{}
+	lp.Restore(state)
+	scheduler = NewScheduler([]*LoadPoint{lp})
+
+	for _, c := range cases[1:4] {
+		scheduler.Update(c.ts.AddDate(0, 0, 7))
+		if mode := lp.CurrentChargeMode(); mode != c.mode {
+			t.Errorf("%v: expected %s after restart, got %s", c.ts, c.mode, mode)
+		}
+	}
+
+	// windows on daylight saving time change
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	schedule = Schedule{
+		Mode: api.ModePV,
+		Entries: []ScheduleEntry{
+			{From: "22:00", To: "06:00", Mode: api.ModeNow},
+			{From: "08:00", To: "09:00", Mode: api.ModeMinPV},
+		},
+	}
+
+	for _, day := range []time.Time{
+		time.Date(2020, 3, 29, 0, 0, 0, 0, loc),
+		time.Date(2020, 10, 25, 0, 0, 0, 0, loc),
+	} {
+		cases := []struct {
+			hour, min int
+			mode      api.ChargeMode
+		}{
+			{5, 30, api.ModeNow},
+			{6, 30, api.ModePV},
+			{7, 30, api.ModePV},
+			{8, 30, api.ModeMinPV},
+			{9, 30, api.ModePV},
+		}
+
+		for _, c := range cases {
+			ts := time.Date(day.Year(), day.Month(), day.Day(), c.hour, c.min, 0, 0, loc)
+			if mode := schedule.mode(ts); mode != c.mode {
+				t.Errorf("%v: expected %s, got %s", ts, c.mode, mode)
+			}
+		}
+	}
+}
+
+func TestSmoothSurplus(t *testing.T) {
+	var c api.Charger
+	lp := NewLoadPoint("lp1", c)
+
+	// no smoothing by default
+	for _, surplus := range []float64{2000, -500, 3000} {
+		if s := lp.smoothSurplus(surplus); s != surplus {
+			t.Errorf("expected %.0f, got %.0f", surplus, s)
+		}
+	}
+
+	// slow increase, fast decrease
+	lp.Smoothing = Smoothing{Increase: 3, Decrease: 1}
+	lp.surplusValid = false
+
+	cases := []struct {
+		surplus, expected float64
+	}{
+		{1000, 1000}, // first reading
+		{3000, 2000},
+		{3000, 2500},
+		{-1000, -1000}, // kettle
+		{1000, 0},
+	}
+
+	for _, c := range cases {
+		if s := lp.smoothSurplus(c.surplus); math.Abs(s-c.expected) > 1e-6 {
+			t.Errorf("%.0f: expected %.0f, got %.0f", c.surplus, c.expected, s)
+		}
+	}
+}
+
+// recordingCharger records the last current and enabled state set
+type recordingCharger struct {
+	stubCharger
+	current int64
+	enabled bool
+}
+
+func (c *recordingCharger) Enable(enable bool) error {
+	c.enabled = enable
+	return nil
+}
+
+func (c *recordingCharger) MaxCurrent(current int64) error {
+	c.current = current
+	return nil
+}
+
+// switchCharger reports the enabled state last set
+type switchCharger struct {
+	recordingCharger
+}
+
+func (c *switchCharger) Enabled() (bool, error) {
+	return c.enabled, nil
+}
+
+func TestChargeModeInvalid(t *testing.T) {
+	charger := &switchCharger{}
+	lp := NewLoadPoint("lp1", charger)
+
+	// unknown or not supported by devices, charger is not touched
+	for _, mode := range []api.ChargeMode{"bogus", api.ModePV, api.ModeCheap} {
+		if err := lp.ChargeMode(mode); err == nil {
+			t.Errorf("%s: expected error", mode)
+		}
+	}
+	if charger.enabled || lp.CurrentChargeMode() != api.ModeNow {
+		t.Errorf("expected disabled charger and unchanged mode, got %v %s", charger.enabled, lp.CurrentChargeMode())
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	charger := &recordingCharger{current: 16, enabled: true}
+	sessions := &testSessions{}
+
+	lp := NewLoadPoint("lp1", charger)
+	lp.Sessions = sessions
+	lp.Safe = SafeState{Current: 6}
+	lp.startCharging()
+
+	if err := lp.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if charger.current != 6 || !charger.enabled {
+		t.Errorf("expected safe current, got %dA enabled %v", charger.current, charger.enabled)
+	}
+	if len(sessions.sessions) != 1 {
+		t.Errorf("expected session to be finalized")
+	}
+
+	lp.Safe = SafeState{Disable: true}
+	if err := lp.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if charger.enabled {
+		t.Error("expected charger to be disabled")
+	}
+
+	// session and mode kept after restart
+	states := testStates{}
+	switched := &switchCharger{recordingCharger{enabled: true}}
+
+	lp = NewLoadPoint("lp1", switched)
+	lp.Sessions = sessions
+	lp.StateStore = states
+	lp.Safe = SafeState{Disable: true}
+	lp.startCharging()
+
+	if err := lp.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if switched.enabled || len(sessions.sessions) != 1 || states["lp1"].Session == nil {
+		t.Errorf("expected disabled charger and saved session, got %v %v", switched.enabled, states["lp1"])
+	}
+
+	lp = NewLoadPoint("lp1", switched)
+	lp.StateStore = states
+	lp.Restore(states["lp1"])
+
+	if enabled, mode := lp.updateChargerEnabled(); !enabled || !switched.enabled || mode != api.ModeNow {
+		t.Errorf("expected charger enabled in mode %s, got %v %s", api.ModeNow, enabled, mode)
+	}
+	if state := lp.State(); state.Session == nil || state.SafeDisabled {
+		t.Errorf("expected session to be continued, got %+v", state)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	charger := &recordingCharger{enabled: true}
+
+	lp := NewLoadPoint("lp1", charger)
+	lp.DryRun = true
+	lp.Safe = SafeState{Disable: true}
+
+	lp.Update()
+	if lp.TargetCurrent() != lp.MaxCurrent || charger.current != 0 {
+		t.Errorf("expected target current %dA not to be set, got %dA charger %dA", lp.MaxCurrent, lp.TargetCurrent(), charger.current)
+	}
+
+	if err := lp.ChargeMode(api.ModeOff); err != nil {
+		t.Fatal(err)
+	}
+	if enabled, _ := lp.ChargerEnabled(); enabled || !charger.enabled {
+		t.Errorf("expected charger to be disabled in dry run only, got %v charger %v", enabled, charger.enabled)
+	}
+
+	// intended state is kept
+	lp.Update()
+	if mode := lp.CurrentChargeMode(); mode != api.ModeOff || lp.TargetCurrent() != 0 {
+		t.Errorf("expected mode off, got %s %dA", mode, lp.TargetCurrent())
+	}
+
+	if err := lp.ChargeMode(api.ModeNow); err != nil {
+		t.Fatal(err)
+	}
+	lp.Update()
+	if mode := lp.CurrentChargeMode(); mode != api.ModeNow || lp.TargetCurrent() != lp.MaxCurrent {
+		t.Errorf("expected mode now, got %s %dA", mode, lp.TargetCurrent())
+	}
+
+	if err := lp.Shutdown(); err != nil || !charger.enabled {
+		t.Errorf("expected charger not to be disabled on shutdown, got %v %v", charger.enabled, err)
+	}
+}
+
+func TestConcurrentSettings(t *testing.T) {
+	lp := NewLoadPoint("lp1", &stubCharger{})
+	lp.GridMeter = &testMeter{power: -3000}
+
+	// settings changed via api while updating
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := int64(0); ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = lp.SetMaxCurrent(6 + i%10)
+			_ = lp.SetPhases(i%3 + 1)
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		mode := []api.ChargeMode{api.ModeNow, api.ModePV, api.ModeMinPV}[i%3]
+		if err := lp.ChargeMode(mode); err != nil {
+			t.Fatal(err)
+		}
+		lp.Update()
+	}
+
+	close(stop)
+	<-done
+}
+
+type socVehicle struct {
+	api.Vehicle
+	soc float64
+}
+
+func (v *socVehicle) ChargeState() (float64, error) {
+	return v.soc, nil
+}
+
+func TestTargetSoC(t *testing.T) {
+	vehicle := &socVehicle{Vehicle: NewVehicle("Zoe", 41), soc: 70}
+
+	lp := NewLoadPoint("lp1", &stubCharger{})
+	lp.Vehicle = vehicle
+	if err := lp.SetTargetSoC(80); err != nil {
+		t.Fatal(err)
+	}
+
+	lp.Update()
+	if lp.TargetCurrent() != lp.MaxCurrent {
+		t.Errorf("expected max current below target soc, got %dA", lp.TargetCurrent())
+	}
+
+	vehicle.soc = 80
+	lp.Update()
+	if lp.TargetCurrent() != 0 {
+		t.Errorf("expected charging to stop at target soc, got %dA", lp.TargetCurrent())
+	}
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"reflect"
+)
+
+// Reconfigure applies the devices, settings and configuration of conf, a
+// loadpoint created from changed configuration, to the running loadpoint.
+// Runtime state like the charge session is kept unless charger or charge
+// meter are replaced, sessions and state store remain unchanged. The
+// loadpoint's update loop must not be running, api calls wait until
+// reconfiguration has finished.
+func (lp *LoadPoint) Reconfigure(conf *LoadPoint) {
+	lp.devicesMux.Lock()
+	defer lp.devicesMux.Unlock()
+
+	Logger.Printf("%s reconfigure", lp.Name)
+
+	// session energy can't be continued on different devices
+	if Untraced(lp.Charger) != conf.Charger || Untraced(lp.ChargeMeter) != conf.ChargeMeter {
+		lp.stopCharging()
+	}
+
+	settings := conf.Settings()
+	schedule := conf.Schedule()
+
+	lp.Lock()
+	lp.Charger = conf.Charger
+	lp.GridMeter = conf.GridMeter
+	lp.PVMeter = conf.PVMeter
+	lp.ChargeMeter = conf.ChargeMeter
+	lp.Vehicle = conf.Vehicle
+	lp.MinCurrent = settings.MinCurrent
+	lp.MaxCurrent = settings.MaxCurrent
+	lp.Voltage = conf.Voltage
+	lp.Phases = settings.Phases
+	lp.TargetSoC = settings.TargetSoC
+	lp.Tariffs = conf.Tariffs
+	lp.Tariff = conf.Tariff
+	lp.Cheap = conf.Cheap
+	lp.Intensity = conf.Intensity
+	lp.Clean = conf.Clean
+	lp.Forecast = conf.Forecast
+	lp.Solar = conf.Solar
+	lp.Smoothing = conf.Smoothing
+	lp.MaxExport = conf.MaxExport
+	lp.Safe = conf.Safe
+
+	// smoothing restarts from current readings
+	lp.surplusValid = false
+
+	// intended charger state is not known to the charger
+	if lp.DryRun != conf.DryRun {
+		lp.DryRun = conf.DryRun
+		lp.dryRunValid = false
+	}
+
+	// scheduled mode is applied on next scheduler run
+	if !reflect.DeepEqual(lp.schedule, schedule) {
+		lp.schedule = schedule
+		lp.scheduled = false
+	}
+
+	mode := lp.Mode
+	lp.Unlock()
+
+	// record replaced devices
+	if lp.recorder != nil {
+		lp.recorder.Record(lp)
+	}
+
+	if settings.Mode != mode {
+		if err := lp.chargeMode(settings.Mode); err != nil {
+			Logger.Printf("%s reconfigure error: %v", lp.Name, err)
+		}
+	}
+
+	lp.persist()
+}
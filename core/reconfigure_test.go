@@ -0,0 +1,72 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/andig/evcc/api"
+)
+
+func TestReconfigure(t *testing.T) {
+	charger := &recordingCharger{enabled: true}
+	meter := &testMeter{energy: 1000}
+	sessions := &testSessions{}
+
+	lp := NewLoadPoint("lp1", charger)
+	lp.ChargeMeter = meter
+	lp.Sessions = sessions
+	lp.startCharging()
+
+	// unchanged devices continue the session
+	conf := NewLoadPoint("lp1", charger)
+	conf.ChargeMeter = meter
+	conf.MaxCurrent = 10
+	conf.Smoothing = Smoothing{Increase: 3}
+	lp.Reconfigure(conf)
+
+	if lp.MaxCurrent != 10 || lp.Smoothing.Increase != 3 || lp.Sessions != sessions {
+		t.Errorf("unexpected config %+v", lp)
+	}
+	if len(sessions.sessions) != 0 {
+		t.Fatalf("expected session to continue, got %+v", sessions.sessions)
+	}
+
+	// replaced charger finishes the session
+	replaced := &recordingCharger{enabled: true}
+	conf = NewLoadPoint("lp1", replaced)
+	conf.ChargeMeter = meter
+	conf.Mode = api.ModeOff
+
+	meter.energy = 2000
+	lp.Reconfigure(conf)
+
+	if lp.Charger != replaced || len(sessions.sessions) != 1 || sessions.sessions[0].Energy != 1000 {
+		t.Errorf("expected session to be finished, got %+v", sessions.sessions)
+	}
+	if lp.CurrentChargeMode() != api.ModeOff || replaced.enabled {
+		t.Errorf("expected mode off, got %s enabled %v", lp.CurrentChargeMode(), replaced.enabled)
+	}
+}
+
+func TestReconfigureConcurrent(t *testing.T) {
+	lp := NewLoadPoint("lp1", &recordingCharger{})
+	lp.GridMeter = &testMeter{}
+
+	// api calls during reconfiguration, run with -race
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = lp.ChargeMode(api.ModePV)
+			_ = lp.ChargeMode(api.ModeOff)
+			lp.Forecasting()
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		conf := NewLoadPoint("lp1", &recordingCharger{})
+		conf.GridMeter = &testMeter{}
+		lp.Reconfigure(conf)
+	}
+
+	<-done
+}
@@ -0,0 +1,266 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andig/evcc/api"
+)
+
+// replayCycle is a recorded update cycle
+type replayCycle struct {
+	start    TraceEvent
+	settings Settings
+	reads    []TraceEvent
+	writes   []TraceEvent
+}
+
+// replayCycles returns the loadpoint's recorded update cycles. Device access
+// outside of update cycles, e.g. by the api, is ignored.
+func replayCycles(name string, trace []TraceEvent) ([]replayCycle, error) {
+	var cycles []replayCycle
+	var cycle *replayCycle
+
+	for _, ev := range trace {
+		if ev.LoadPoint != name {
+			continue
+		}
+
+		switch {
+		case ev.Op == opUpdate:
+			b, err := json.Marshal(ev.Value)
+			if err != nil {
+				return nil, err
+			}
+
+			cycles = append(cycles, replayCycle{start: ev})
+			cycle = &cycles[len(cycles)-1]
+			if err := json.Unmarshal(b, &cycle.settings); err != nil {
+				return nil, err
+			}
+
+		case ev.Op == opUpdated:
+			cycle = nil
+
+		case cycle == nil:
+
+		case ev.Op == opEnable || ev.Op == opMaxCurrent:
+			cycle.writes = append(cycle.writes, ev)
+
+		default:
+			cycle.reads = append(cycle.reads, ev)
+		}
+	}
+
+	if len(cycles) == 0 {
+		return nil, fmt.Errorf("%s: no update cycles recorded", name)
+	}
+
+	return cycles, nil
+}
+
+// replay serves recorded readings to the loadpoint and collects its writes
+type replay struct {
+	queued map[string][]TraceEvent // readings of the cycle by device and operation
+	last   map[string]TraceEvent   // last reading served by device and operation
+	writes []TraceEvent
+}
+
+// cycle queues the cycle's readings to be served in recorded order
+func (r *replay) cycle(reads []TraceEvent) {
+	r.queued = make(map[string][]TraceEvent)
+	for _, ev := range reads {
+		key := ev.Device + "." + ev.Op
+		r.queued[key] = append(r.queued[key], ev)
+	}
+}
+
+// read serves the next queued reading or repeats the last one if the
+// loadpoint reads more often than recorded
+func (r *replay) read(device, op string) (interface{}, error) {
+	key := device + "." + op
+	if queued := r.queued[key]; len(queued) > 0 {
+		r.last[key] = queued[0]
+		r.queued[key] = queued[1:]
+	}
+
+	ev, ok := r.last[key]
+	if !ok {
+		return nil, fmt.Errorf("%s %s not recorded", device, op)
+	}
+	if ev.Error != "" {
+		return nil, errors.New(ev.Error)
+	}
+	return ev.Value, nil
+}
+
+func (r *replay) float(device, op string) (float64, error) {
+	val, err := r.read(device, op)
+	if err != nil {
+		return 0, err
+	}
+	f, _ := val.(float64)
+	return f, nil
+}
+
+func (r *replay) write(op string, val interface{}) error {
+	r.writes = append(r.writes, TraceEvent{Device: "charger", Op: op, Value: val})
+	return nil
+}
+
+// replayCharger is a controllable charger replaying recorded readings
+type replayCharger struct {
+	*replay
+}
+
+func (c *replayCharger) Status() (api.ChargeStatus, error) {
+	val, err := c.read("charger", opStatus)
+	s, _ := val.(string)
+	return api.ChargeStatus(s), err
+}
+
+func (c *replayCharger) Enabled() (bool, error) {
+	val, err := c.read("charger", opEnabled)
+	b, _ := val.(bool)
+	return b, err
+}
+
+func (c *replayCharger) Enable(enable bool) error {
+	return c.write(opEnable, enable)
+}
+
+func (c *replayCharger) ActualCurrent() (int64, error) {
+	f, err := c.float("charger", opActualCurrent)
+	return int64(f), err
+}
+
+func (c *replayCharger) MaxCurrent(current int64) error {
+	return c.write(opMaxCurrent, current)
+}
+
+// replayMeter replays recorded meter readings
+type replayMeter struct {
+	*replay
+	device string
+}
+
+func (m *replayMeter) CurrentPower() (float64, error) {
+	return m.float(m.device, opPower)
+}
+
+// replayEnergyMeter replays recorded meter readings including energy
+type replayEnergyMeter struct {
+	*replayMeter
+}
+
+func (m *replayEnergyMeter) TotalEnergy() (float64, error) {
+	return m.float(m.device, opEnergy)
+}
+
+// replayVehicle replays recorded vehicle state of charge
+type replayVehicle struct {
+	api.Vehicle
+	*replay
+}
+
+func (v *replayVehicle) ChargeState() (float64, error) {
+	return v.float("vehicle", opSoC)
+}
+
+// formatWrites formats charger writes for comparison
+func formatWrites(writes []TraceEvent) string {
+	var res []string
+	for _, ev := range writes {
+		switch v := ev.Value.(type) {
+		case float64:
+			res = append(res, fmt.Sprintf("%s %d", ev.Op, int64(v)))
+		default:
+			res = append(res, fmt.Sprintf("%s %v", ev.Op, v))
+		}
+	}
+
+	if len(res) == 0 {
+		return "none"
+	}
+	return strings.Join(res, ", ")
+}
+
+// Replay drives the loadpoint by a recorded trace. The loadpoint's charger,
+// meters and vehicle are replaced by devices serving the recorded readings in
+// order, each recorded update cycle is repeated with its recorded settings. Charger
+// writes differing from the recorded ones are returned as errors. Other
+// configuration like smoothing is taken from the loadpoint, time dependent
+// charge modes use the current time.
+func Replay(lp *LoadPoint, trace []TraceEvent) []error {
+	cycles, err := replayCycles(lp.Name, trace)
+	if err != nil {
+		return []error{err}
+	}
+
+	r := &replay{last: make(map[string]TraceEvent)}
+	lp.Charger = &replayCharger{r}
+
+	// vehicle keeps its configured title
+	vehicle := lp.Vehicle
+	if vehicle == nil {
+		vehicle = NewVehicle("", 0)
+	}
+	lp.Vehicle = nil
+
+	// meters and vehicle are assigned as recorded
+	lp.GridMeter, lp.PVMeter, lp.ChargeMeter = nil, nil, nil
+	for _, c := range cycles {
+		for _, ev := range c.reads {
+			var meter *api.Meter
+			switch ev.Device {
+			case "grid":
+				meter = &lp.GridMeter
+			case "pv":
+				meter = &lp.PVMeter
+			case "charge":
+				meter = &lp.ChargeMeter
+			case "vehicle":
+				lp.Vehicle = &replayVehicle{Vehicle: vehicle, replay: r}
+				continue
+			default:
+				continue
+			}
+
+			m := &replayMeter{replay: r, device: ev.Device}
+			if ev.Op == opEnergy {
+				*meter = &replayEnergyMeter{m}
+			} else if *meter == nil {
+				*meter = m
+			}
+		}
+	}
+
+	var errs []error
+	for _, c := range cycles {
+		r.cycle(c.reads)
+
+		lp.Lock()
+		lp.Mode = c.settings.Mode
+		lp.MinCurrent = c.settings.MinCurrent
+		lp.MaxCurrent = c.settings.MaxCurrent
+		lp.Phases = c.settings.Phases
+		lp.TargetSoC = c.settings.TargetSoC
+		lp.Unlock()
+
+		r.writes = nil
+		lp.Update()
+
+		// compare via json to match recorded value types
+		b, _ := json.Marshal(r.writes)
+		var actual []TraceEvent
+		_ = json.Unmarshal(b, &actual)
+
+		if expected, got := formatWrites(c.writes), formatWrites(actual); expected != got {
+			errs = append(errs, fmt.Errorf("%s: expected %s, got %s", c.start.Time.Format("2006-01-02 15:04:05"), expected, got))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/andig/evcc/api"
+)
+
+func TestRecordReplay(t *testing.T) {
+	charger := &recordingCharger{}
+	var b bytes.Buffer
+
+	lp := NewLoadPoint("lp1", charger)
+	lp.GridMeter = &testMeter{power: -2300}
+	lp.Mode = api.ModePV
+	NewRecorder(&b).Record(lp)
+
+	if _, ok := lp.Charger.(api.ChargeController); !ok {
+		t.Fatal("expected recorded charger to be controllable")
+	}
+
+	lp.Update()
+	if charger.current != 10 {
+		t.Errorf("expected 10A, got %dA", charger.current)
+	}
+
+	// reads outside of update cycles are not recorded
+	if _, err := lp.ChargerEnabled(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Untraced(lp.GridMeter).(api.Meter).CurrentPower(); err != nil {
+		t.Fatal(err)
+	}
+
+	trace, err := ReadTrace(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := trace[len(trace)-1]; ev.Op != opUpdated {
+		t.Errorf("unexpected event after update cycle %+v", ev)
+	}
+
+	if errs := Replay(NewLoadPoint("lp1", nil), trace); len(errs) > 0 {
+		t.Errorf("unexpected replay errors %v", errs)
+	}
+
+	// changed behavior is reported
+	lp = NewLoadPoint("lp1", nil)
+	lp.MaxExport = 1150
+	trace[0].Value = map[string]interface{}{"mode": "feedinlimit", "minCurrent": 5, "maxCurrent": 16, "phases": 1}
+	if errs := Replay(lp, trace); len(errs) != 1 {
+		t.Errorf("expected replay error, got %v", errs)
+	}
+}
+
+func TestReplayPV(t *testing.T) {
+	f, err := os.Open("testdata/pv.trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	trace, err := ReadTrace(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, err := range Replay(NewLoadPoint("lp1", nil), trace) {
+		t.Error(err)
+	}
+}
+
+func TestRecordReplayVehicle(t *testing.T) {
+	vehicle := &socVehicle{Vehicle: NewVehicle("Zoe", 41), soc: 70}
+	var b bytes.Buffer
+
+	lp := NewLoadPoint("lp1", &recordingCharger{})
+	lp.Vehicle = vehicle
+	lp.TargetSoC = 80
+	NewRecorder(&b).Record(lp)
+
+	if lp.Vehicle.Title() != "Zoe" || Untraced(lp.Vehicle) != vehicle {
+		t.Errorf("expected recorded vehicle to wrap %v", vehicle)
+	}
+
+	lp.Update()
+	vehicle.soc = 80
+	lp.Update()
+
+	trace, err := ReadTrace(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stopping at target soc depends on the recorded soc
+	if errs := Replay(NewLoadPoint("lp1", nil), trace); len(errs) > 0 {
+		t.Errorf("unexpected replay errors %v", errs)
+	}
+}
+
+func TestReplayOrder(t *testing.T) {
+	r := &replay{last: make(map[string]TraceEvent)}
+	r.cycle([]TraceEvent{
+		{Device: "grid", Op: opPower, Value: 100.0},
+		{Device: "grid", Op: opPower, Value: 200.0},
+	})
+
+	// readings in recorded order, last reading repeated
+	for _, expected := range []float64{100, 200, 200} {
+		if f, err := r.float("grid", opPower); err != nil || f != expected {
+			t.Errorf("expected %.0f, got %.0f: %v", expected, f, err)
+		}
+	}
+
+	if _, err := r.float("pv", opPower); err == nil {
+		t.Error("expected error for reading not recorded")
+	}
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Repeat calls fn immediately and then in given interval until ctx is
+// cancelled. Panics in fn are recovered and logged, the next call happens as
+// scheduled.
+func Repeat(ctx context.Context, name string, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		safeCall(name, fn)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// safeCall calls fn recovering from panics
+func safeCall(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("%s panic: %v\n%s", name, r, debug.Stack())
+		}
+	}()
+
+	fn()
+}
+
+// watchdog reports update cycles running longer than timeout
+type watchdog struct {
+	sync.Mutex
+	name     string
+	timeout  time.Duration
+	started  time.Time // zero while idle
+	reported bool
+}
+
+func newWatchdog(name string, timeout time.Duration) *watchdog {
+	return &watchdog{name: name, timeout: timeout}
+}
+
+// start marks the beginning of a cycle
+func (w *watchdog) start() {
+	w.Lock()
+	defer w.Unlock()
+	w.started = time.Now()
+	w.reported = false
+}
+
+// done marks the end of a cycle
+func (w *watchdog) done() {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.reported {
+		log.Printf("%s update recovered after %v", w.name, time.Since(w.started).Round(time.Millisecond))
+	}
+	w.started = time.Time{}
+}
+
+// check reports the current cycle once if it exceeded the timeout
+func (w *watchdog) check(ts time.Time) bool {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.started.IsZero() || w.reported || ts.Sub(w.started) < w.timeout {
+		return false
+	}
+
+	w.reported = true
+	log.Printf("%s update stuck for %v", w.name, ts.Sub(w.started).Round(time.Second))
+
+	return true
+}
+
+// run checks for stuck cycles until ctx is cancelled
+func (w *watchdog) run(ctx context.Context) {
+	ticker := time.NewTicker(w.timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ts := <-ticker.C:
+			w.check(ts)
+		}
+	}
+}
+
+// Run updates the loadpoint in given interval until ctx is cancelled. Update
+// cycles running longer than timeout are reported by a watchdog.
+func (lp *LoadPoint) Run(ctx context.Context, interval, timeout time.Duration) {
+	w := newWatchdog(lp.Name, timeout)
+	go w.run(ctx)
+
+	Repeat(ctx, lp.Name, interval, func() {
+		w.start()
+		defer w.done()
+
+		Logger.Printf("%s ---", lp.Name)
+		lp.Update()
+	})
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRepeat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	done := make(chan struct{})
+	go func() {
+		Repeat(ctx, "test", time.Millisecond, func() {
+			calls++
+			if calls == 3 {
+				cancel()
+			}
+			panic("failed")
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected repeat to stop after cancel")
+	}
+
+	if calls < 3 {
+		t.Errorf("expected calls to continue after panic, got %d", calls)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	w := newWatchdog("lp1", time.Minute)
+	now := time.Now()
+
+	if w.check(now.Add(time.Hour)) {
+		t.Error("expected idle watchdog not to report")
+	}
+
+	w.start()
+	if w.check(now.Add(30 * time.Second)) {
+		t.Error("expected no report before timeout")
+	}
+	if !w.check(now.Add(2 * time.Minute)) {
+		t.Error("expected stuck cycle to be reported")
+	}
+	if w.check(now.Add(3 * time.Minute)) {
+		t.Error("expected stuck cycle to be reported once")
+	}
+	w.done()
+
+	if w.check(now.Add(time.Hour)) {
+		t.Error("expected finished cycle not to report")
+	}
+}
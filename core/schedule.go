@@ -0,0 +1,250 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andig/evcc/api"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ScheduleEntry sets the charge mode during a weekly time window
+type ScheduleEntry struct {
+	Days []string       `json:"days,omitempty"` // mon..sun of window start, empty for every day
+	From string         `json:"from"`           // 15:04
+	To   string         `json:"to"`             // 15:04, may extend over midnight
+	Mode api.ChargeMode `json:"mode"`
+}
+
+// Schedule switches charge modes at weekly time boundaries. Entries are
+// matched in order, Mode applies outside of all entries. An empty Mode
+// leaves the charge mode unchanged outside of entries.
+type Schedule struct {
+	Mode    api.ChargeMode  `json:"mode,omitempty"`
+	Entries []ScheduleEntry `json:"entries"`
+}
+
+// Empty checks if the schedule never changes the charge mode
+func (s Schedule) Empty() bool {
+	return s.Mode == "" && len(s.Entries) == 0
+}
+
+// ValidMode checks if mode is a known charge mode
+func ValidMode(mode api.ChargeMode) bool {
+	switch mode {
+	case api.ModeOff, api.ModeNow, api.ModeMinPV, api.ModePV, api.ModeCheap, api.ModeClean, api.ModeFeedInLimit:
+		return true
+	}
+	return false
+}
+
+// Validate checks modes, days and times of the schedule
+func (s Schedule) Validate() error {
+	if s.Mode != "" && !ValidMode(s.Mode) {
+		return fmt.Errorf("invalid charge mode: %s", s.Mode)
+	}
+
+	for _, e := range s.Entries {
+		if _, _, err := e.window(); err != nil {
+			return err
+		}
+
+		if !ValidMode(e.Mode) {
+			return fmt.Errorf("invalid charge mode: %s", e.Mode)
+		}
+
+		for _, d := range e.Days {
+			if _, ok := weekdays[strings.ToLower(d)]; !ok {
+				return fmt.Errorf("invalid day '%s'", d)
+			}
+		}
+	}
+
+	return nil
+}
+
+// window returns start and end of the entry's daily time window as time of
+// day. End exceeds 24h if the window extends over midnight.
+func (e ScheduleEntry) window() (time.Duration, time.Duration, error) {
+	from, err := api.ParseTimeOfDay(e.From)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	to, err := api.ParseTimeOfDay(e.To)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if from == to {
+		return 0, 0, fmt.Errorf("empty schedule window %s-%s", e.From, e.To)
+	}
+
+	if to < from {
+		to += 24 * time.Hour
+	}
+
+	return from, to, nil
+}
+
+// activeOn checks if the entry applies to windows starting on weekday
+func (e ScheduleEntry) activeOn(day time.Weekday) bool {
+	if len(e.Days) == 0 {
+		return true
+	}
+
+	for _, d := range e.Days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+// windows calls fn with start and end of the entry's windows that may
+// contain ts or started during the previous week. Windows are local wall
+// clock times, also on daylight saving time changes.
+func (e ScheduleEntry) windows(ts time.Time, fn func(start, end time.Time)) {
+	from, to, err := e.window()
+	if err != nil {
+		return
+	}
+
+	at := func(day int, d time.Duration) time.Time {
+		return time.Date(ts.Year(), ts.Month(), ts.Day()+day, int(d/time.Hour), int(d%time.Hour/time.Minute), 0, 0, ts.Location())
+	}
+
+	for d := -7; d <= 0; d++ {
+		if start := at(d, from); e.activeOn(start.Weekday()) {
+			fn(start, at(d, to))
+		}
+	}
+}
+
+// mode returns the scheduled charge mode at ts
+func (s Schedule) mode(ts time.Time) api.ChargeMode {
+	for _, e := range s.Entries {
+		active := false
+		e.windows(ts, func(start, end time.Time) {
+			if !start.After(ts) && end.After(ts) {
+				active = true
+			}
+		})
+
+		if active {
+			return e.Mode
+		}
+	}
+
+	return s.Mode
+}
+
+// boundary returns the last window start or end at or before ts
+func (s Schedule) boundary(ts time.Time) time.Time {
+	var last time.Time
+	for _, e := range s.Entries {
+		e.windows(ts, func(start, end time.Time) {
+			for _, b := range []time.Time{start, end} {
+				if !b.After(ts) && b.After(last) {
+					last = b
+				}
+			}
+		})
+	}
+
+	return last
+}
+
+// Schedule returns the loadpoint's charge mode schedule
+func (lp *LoadPoint) Schedule() Schedule {
+	lp.Lock()
+	defer lp.Unlock()
+	return lp.schedule
+}
+
+// SetSchedule updates the charge mode schedule. The scheduled mode is applied
+// immediately.
+func (lp *LoadPoint) SetSchedule(schedule Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+
+	Logger.Printf("%s set schedule: %+v", lp.Name, schedule)
+
+	defer lp.persist()
+	lp.Lock()
+	defer lp.Unlock()
+
+	lp.schedule = schedule
+	lp.scheduled = false
+
+	return nil
+}
+
+// updateSchedule switches to the scheduled charge mode when a schedule
+// boundary has been passed. Manual mode changes remain until the next boundary.
+func (lp *LoadPoint) updateSchedule(ts time.Time) {
+	lp.Lock()
+	if lp.schedule.Empty() {
+		lp.Unlock()
+		return
+	}
+
+	boundary := lp.schedule.boundary(ts)
+	if lp.scheduled && boundary.Equal(lp.scheduleBoundary) {
+		lp.Unlock()
+		return
+	}
+
+	lp.scheduled = true
+	lp.scheduleBoundary = boundary
+
+	mode, current := lp.schedule.mode(ts), lp.Mode
+	lp.Unlock()
+
+	if mode == "" || mode == current {
+		lp.persist()
+		return
+	}
+
+	Logger.Printf("%s scheduled charge mode: %s", lp.Name, mode)
+	if err := lp.ChargeMode(mode); err != nil {
+		Logger.Printf("%s schedule error: %v", lp.Name, err)
+	}
+}
+
+// Scheduler switches the charge modes of loadpoints according to their schedules
+type Scheduler struct {
+	loadPoints []*LoadPoint
+}
+
+// NewScheduler creates a scheduler for the given loadpoints
+func NewScheduler(loadPoints []*LoadPoint) *Scheduler {
+	return &Scheduler{loadPoints: loadPoints}
+}
+
+// Update applies schedule boundaries passed at ts
+func (s *Scheduler) Update(ts time.Time) {
+	for _, lp := range s.loadPoints {
+		lp.updateSchedule(ts)
+	}
+}
+
+// Run checks schedules in given interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	Repeat(ctx, "scheduler", interval, func() {
+		s.Update(time.Now())
+	})
+}
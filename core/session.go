@@ -0,0 +1,44 @@
+package core
+
+import (
+	"time"
+)
+
+// Session is a finished charge session
+type Session struct {
+	ID         uint64    `json:"id"`
+	LoadPoint  string    `json:"loadpoint"`
+	Vehicle    string    `json:"vehicle,omitempty"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Energy     float64   `json:"energy"`     // Wh
+	MaxCurrent int64     `json:"maxCurrent"` // A
+
+	SolarPercentage float64 `json:"solarPercentage"` // share of energy from pv surplus
+	Cost            float64 `json:"cost"`
+	Savings         float64 `json:"savings"` // compared to charging from grid only
+	Currency        string  `json:"currency,omitempty"`
+	CO2             float64 `json:"co2"` // g, from grid energy
+}
+
+// SessionFilter selects sessions. Empty fields match all sessions.
+type SessionFilter struct {
+	LoadPoint string
+	Vehicle   string
+	From      time.Time // sessions started at or after
+	To        time.Time // sessions started before
+}
+
+// Match checks if session is selected by the filter
+func (f SessionFilter) Match(s Session) bool {
+	return (f.LoadPoint == "" || f.LoadPoint == s.LoadPoint) &&
+		(f.Vehicle == "" || f.Vehicle == s.Vehicle) &&
+		(f.From.IsZero() || !s.Start.Before(f.From)) &&
+		(f.To.IsZero() || s.Start.Before(f.To))
+}
+
+// SessionStore persists finished charge sessions
+type SessionStore interface {
+	AddSession(session Session) error
+	Sessions(filter SessionFilter) ([]Session, error)
+}
@@ -0,0 +1,40 @@
+package core
+
+import (
+	"github.com/andig/evcc/api"
+)
+
+// SafeState is the charger state left behind when evcc stops
+type SafeState struct {
+	Current int64 // A, max current set on shutdown, 0 keeps current
+	Disable bool  // disable charger on shutdown
+}
+
+// Shutdown leaves the charger in its safe state and saves the charge session
+// to be continued after restart. Without state store the session is
+// finalized. The control loop must be stopped before.
+func (lp *LoadPoint) Shutdown() error {
+	var err error
+	switch {
+	case lp.Safe.Disable:
+		Logger.Printf("%s shutdown: disable charger", lp.Name)
+		if err = lp.enableCharger(lp.Charger, false); err == nil {
+			lp.Lock()
+			lp.safeDisabled = true
+			lp.Unlock()
+		}
+	case lp.Safe.Current > 0:
+		if _, ok := lp.Charger.(api.ChargeController); ok {
+			Logger.Printf("%s shutdown: set charge current %dA", lp.Name, lp.Safe.Current)
+			err = lp.setMaxCurrent(lp.Safe.Current)
+		}
+	}
+
+	if lp.StateStore != nil {
+		lp.persist()
+	} else {
+		lp.stopCharging()
+	}
+
+	return err
+}
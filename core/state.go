@@ -0,0 +1,170 @@
+package core
+
+import (
+	"time"
+
+	"github.com/andig/evcc/api"
+)
+
+// State is the loadpoint's runtime state persisted across restarts
+type State struct {
+	Settings
+	Schedule         *Schedule     `json:"schedule,omitempty"`
+	ScheduleBoundary *time.Time    `json:"scheduleBoundary,omitempty"` // last schedule boundary applied
+	Session          *SessionState `json:"session,omitempty"`
+	SafeDisabled     bool          `json:"safeDisabled,omitempty"` // charger disabled by shutdown
+}
+
+// SessionState is the state of an in-flight charge session
+type SessionState struct {
+	Start       time.Time `json:"start"`
+	StartEnergy float64   `json:"startEnergy"`
+	MaxCurrent  int64     `json:"maxCurrent"`
+	SolarEnergy float64   `json:"solarEnergy"`
+	GridEnergy  float64   `json:"gridEnergy"`
+	Cost        float64   `json:"cost"`
+	Savings     float64   `json:"savings"`
+	CO2         float64   `json:"co2"`
+}
+
+// StateStore persists loadpoint state across restarts
+type StateStore interface {
+	SaveState(loadPoint string, state State) error
+	// LoadState returns nil if no state has been saved
+	LoadState(loadPoint string) (*State, error)
+}
+
+// State returns a consistent copy of the loadpoint's runtime state
+func (lp *LoadPoint) State() State {
+	state := State{Settings: lp.Settings()}
+
+	lp.Lock()
+	defer lp.Unlock()
+
+	state.SafeDisabled = lp.safeDisabled
+
+	schedule := lp.schedule
+	state.Schedule = &schedule
+	if lp.scheduled {
+		boundary := lp.scheduleBoundary
+		state.ScheduleBoundary = &boundary
+	}
+
+	if lp.isCharging {
+		state.Session = &SessionState{
+			Start:       lp.chargeStartTime,
+			StartEnergy: lp.chargeStartEnergy,
+			MaxCurrent:  lp.chargeMaxCurrent,
+			SolarEnergy: lp.chargeSolarEnergy,
+			GridEnergy:  lp.chargeGridEnergy,
+			Cost:        lp.chargeCost,
+			Savings:     lp.chargeSavings,
+			CO2:         lp.chargeCO2,
+		}
+	}
+
+	return state
+}
+
+// Restore applies previously saved state. Settings not valid for the current
+// configuration are ignored. An in-flight session is continued if the vehicle
+// is still connected and finished otherwise.
+func (lp *LoadPoint) Restore(state State) {
+	lp.Lock()
+	defer lp.Unlock()
+
+	Logger.Printf("%s restore state: %+v", lp.Name, state.Settings)
+
+	// configuration may have changed since state was saved
+	_, chargerControllable := lp.Charger.(api.ChargeController)
+	switch state.Mode {
+	case api.ModeOff, api.ModeNow:
+		lp.Mode = state.Mode
+	case api.ModeMinPV, api.ModePV:
+		if lp.GridMeter != nil && chargerControllable {
+			lp.Mode = state.Mode
+		}
+	case api.ModeFeedInLimit:
+		if lp.MaxExport > 0 && lp.GridMeter != nil && chargerControllable {
+			lp.Mode = state.Mode
+		}
+	case api.ModeCheap:
+		if lp.Tariff != nil && chargerControllable {
+			lp.Mode = state.Mode
+		}
+	case api.ModeClean:
+		if lp.Intensity != nil && lp.GridMeter != nil && chargerControllable {
+			lp.Mode = state.Mode
+		}
+	}
+	if lp.validCurrent(state.MinCurrent) && lp.validCurrent(state.MaxCurrent) && state.MinCurrent <= state.MaxCurrent {
+		lp.MinCurrent = state.MinCurrent
+		lp.MaxCurrent = state.MaxCurrent
+	}
+	if state.Phases >= 1 && state.Phases <= 3 {
+		lp.Phases = state.Phases
+	}
+	if state.TargetSoC > 0 && state.TargetSoC <= 100 {
+		lp.TargetSoC = state.TargetSoC
+	}
+	if s := state.Schedule; s != nil && s.Validate() == nil {
+		lp.schedule = *s
+		lp.scheduled = false
+
+		// keep manual mode until the next boundary
+		if b := state.ScheduleBoundary; b != nil {
+			lp.scheduled = true
+			lp.scheduleBoundary = *b
+		}
+	}
+
+	// charger is enabled again in the restored mode
+	lp.safeDisabled = state.SafeDisabled
+
+	if s := state.Session; s != nil {
+		Logger.Printf("%s restore session started %v", lp.Name, s.Start)
+
+		lp.isCharging = true
+		lp.chargeStartTime = s.Start
+		lp.chargeStartEnergy = s.StartEnergy
+		lp.chargeMaxCurrent = s.MaxCurrent
+		lp.chargeSolarEnergy = s.SolarEnergy
+		lp.chargeGridEnergy = s.GridEnergy
+		lp.chargeCost = s.Cost
+		lp.chargeSavings = s.Savings
+		lp.chargeCO2 = s.CO2
+
+		// downtime is not accounted
+		lp.accountedAt = time.Time{}
+	}
+}
+
+// persistInterval limits saving session accounting while charging
+const persistInterval = time.Minute
+
+// persist saves the loadpoint's state
+func (lp *LoadPoint) persist() {
+	if lp.StateStore == nil {
+		return
+	}
+
+	lp.Lock()
+	lp.persistedAt = time.Now()
+	lp.Unlock()
+
+	if err := lp.StateStore.SaveState(lp.Name, lp.State()); err != nil {
+		Logger.Printf("%s save state error: %v", lp.Name, err)
+	}
+}
+
+// persistSession saves the running session's accounting if not saved within
+// persistInterval. Settings and session start and end are saved immediately.
+func (lp *LoadPoint) persistSession() {
+	lp.Lock()
+	due := lp.isCharging && time.Since(lp.persistedAt) >= persistInterval
+	lp.Unlock()
+
+	if due {
+		lp.persist()
+	}
+}
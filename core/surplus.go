@@ -0,0 +1,38 @@
+package core
+
+// Smoothing configures the exponential moving average applied to pv surplus.
+// Decreasing surplus is typically followed quickly to avoid grid import,
+// increasing surplus slowly to not chase short spikes.
+type Smoothing struct {
+	Increase int // readings averaged when surplus increases, 1 for no smoothing
+	Decrease int // readings averaged when surplus decreases, 1 for no smoothing
+}
+
+// alpha returns the filter weight of a new reading averaged over n readings
+func alpha(n int) float64 {
+	if n <= 1 {
+		return 1
+	}
+	return 2 / float64(n+1)
+}
+
+// smoothSurplus adds a surplus reading to the filter and returns the smoothed surplus
+func (lp *LoadPoint) smoothSurplus(surplus float64) float64 {
+	lp.Lock()
+	defer lp.Unlock()
+
+	if !lp.surplusValid {
+		lp.surplus = surplus
+		lp.surplusValid = true
+		return surplus
+	}
+
+	n := lp.Smoothing.Increase
+	if surplus < lp.surplus {
+		n = lp.Smoothing.Decrease
+	}
+
+	lp.surplus += alpha(n) * (surplus - lp.surplus)
+
+	return lp.surplus
+}
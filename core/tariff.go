@@ -0,0 +1,136 @@
+package core
+
+import (
+	"sort"
+	"time"
+
+	"github.com/andig/evcc/api"
+)
+
+// CheapCharging configures when cheap mode charges from grid
+type CheapCharging struct {
+	PriceLimit float64       // charge if price is at or below limit
+	Duration   time.Duration // charge during cheapest slots of total duration before departure
+	Departure  time.Duration // time of day since midnight
+}
+
+// currentRate returns the rate of the time slot containing ts
+func currentRate(rates []api.Rate, ts time.Time) (api.Rate, bool) {
+	for _, r := range rates {
+		if !r.Start.After(ts) && r.End.After(ts) {
+			return r, true
+		}
+	}
+	return api.Rate{}, false
+}
+
+// nextDeparture returns the next occurrence of departure time of day after ts.
+// Departure is local wall clock time, also on daylight saving time changes.
+func nextDeparture(ts time.Time, departure time.Duration) time.Time {
+	hour, min := int(departure/time.Hour), int(departure%time.Hour/time.Minute)
+
+	next := time.Date(ts.Year(), ts.Month(), ts.Day(), hour, min, 0, 0, ts.Location())
+	if !next.After(ts) {
+		next = time.Date(ts.Year(), ts.Month(), ts.Day()+1, hour, min, 0, 0, ts.Location())
+	}
+
+	return next
+}
+
+// lowestSlot checks if ts is within the lowest value slots of total duration
+// between from and departure
+func lowestSlot(rates []api.Rate, from, ts, departure time.Time, duration time.Duration) bool {
+	var slots []api.Rate
+	for _, r := range rates {
+		if r.End.After(from) && r.Start.Before(departure) {
+			slots = append(slots, r)
+		}
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		return slots[i].Value < slots[j].Value
+	})
+
+	var total time.Duration
+	for _, r := range slots {
+		if total >= duration {
+			break
+		}
+
+		if !r.Start.After(ts) && r.End.After(ts) {
+			return true
+		}
+
+		start, end := r.Start, r.End
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(departure) {
+			end = departure
+		}
+		total += end.Sub(start)
+	}
+
+	return false
+}
+
+// gridPrice returns the grid price at ts from the tariff or the static grid price
+func (lp *LoadPoint) gridPrice(ts time.Time) float64 {
+	if lp.Tariff != nil {
+		rates, err := lp.Tariff.Rates()
+		if err != nil {
+			Logger.Printf("%s tariff error: %v", lp.Name, err)
+		} else if r, ok := currentRate(rates, ts); ok {
+			return r.Value
+		}
+	}
+
+	return lp.Tariffs.Grid
+}
+
+// cheap checks if charging from grid is cheap at ts. If prices are not
+// available, charging is allowed to not leave the vehicle empty.
+func (lp *LoadPoint) cheap(ts time.Time) bool {
+	rates, err := lp.Tariff.Rates()
+	if err != nil {
+		Logger.Printf("%s tariff error: %v", lp.Name, err)
+		return true
+	}
+
+	r, ok := currentRate(rates, ts)
+	if !ok {
+		Logger.Printf("%s no price available", lp.Name)
+		return true
+	}
+	Logger.Printf("%s grid price: %.3f", lp.Name, r.Value)
+
+	return lp.planned(rates, r, ts, lp.Cheap.PriceLimit, lp.Cheap.Duration, lp.Cheap.Departure)
+}
+
+// planned checks if the current rate r is at or below limit or ts is within
+// the lowest value slots of total duration before departure
+func (lp *LoadPoint) planned(rates []api.Rate, r api.Rate, ts time.Time, limit float64, duration, departure time.Duration) bool {
+	if limit > 0 && r.Value <= limit {
+		return true
+	}
+
+	if duration > 0 {
+		next := nextDeparture(ts, departure)
+
+		// plan from vehicle connection, slots already passed count as charged
+		from := ts
+		lp.Lock()
+		if lp.isCharging {
+			from = lp.chargeStartTime
+		}
+		lp.Unlock()
+
+		if earliest := next.AddDate(0, 0, -1); from.Before(earliest) {
+			from = earliest
+		}
+
+		return lowestSlot(rates, from, ts, next, duration)
+	}
+
+	return false
+}
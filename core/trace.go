@@ -0,0 +1,260 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/andig/evcc/api"
+)
+
+// trace operations
+const (
+	opUpdate        = "update"  // update cycle started, value are the loadpoint settings
+	opUpdated       = "updated" // update cycle finished
+	opStatus        = "status"
+	opEnabled       = "enabled"
+	opActualCurrent = "actualCurrent"
+	opEnable        = "enable"
+	opMaxCurrent    = "maxCurrent"
+	opPower         = "power"
+	opEnergy        = "energy"
+	opSoC           = "soc"
+)
+
+// TraceEvent is a device read or write of a loadpoint
+type TraceEvent struct {
+	Time      time.Time   `json:"ts"`
+	LoadPoint string      `json:"loadpoint"`
+	Device    string      `json:"device"` // charger, grid, pv, charge, vehicle or loadpoint
+	Op        string      `json:"op"`
+	Value     interface{} `json:"val,omitempty"`
+	Error     string      `json:"err,omitempty"`
+}
+
+// ReadTrace reads trace events written by a Recorder
+func ReadTrace(r io.Reader) ([]TraceEvent, error) {
+	var trace []TraceEvent
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var ev TraceEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, err
+		}
+		trace = append(trace, ev)
+	}
+
+	return trace, scanner.Err()
+}
+
+// Recorder writes device reads and writes of loadpoints as json lines
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecorder creates a recorder writing to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+func (r *Recorder) record(lp, device, op string, val interface{}, err error) {
+	ev := TraceEvent{
+		Time:      time.Now(),
+		LoadPoint: lp,
+		Device:    device,
+		Op:        op,
+		Value:     val,
+	}
+	if err != nil {
+		ev.Value = nil
+		ev.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.enc.Encode(ev); err != nil {
+		log.Printf("recorder: %v", err)
+	}
+}
+
+// Record replaces the loadpoint's charger, meters and vehicle with recording
+// ones. Update cycles are recorded with the loadpoint's settings.
+func (r *Recorder) Record(lp *LoadPoint) {
+	lp.recorder = r
+
+	tc := &traceCharger{Charger: lp.Charger, rec: r, lp: lp.Name}
+	lp.Charger = tc
+	if cc, ok := tc.Charger.(api.ChargeController); ok {
+		lp.Charger = &traceController{traceCharger: tc, cc: cc}
+
+		if _, ok := tc.Charger.(api.CurrentLimiter); ok {
+			lp.Charger = &traceLimitedController{lp.Charger.(*traceController)}
+		}
+	}
+
+	for _, m := range []struct {
+		device string
+		meter  *api.Meter
+	}{
+		{"grid", &lp.GridMeter},
+		{"pv", &lp.PVMeter},
+		{"charge", &lp.ChargeMeter},
+	} {
+		if *m.meter == nil {
+			continue
+		}
+
+		tm := &traceMeter{Meter: *m.meter, rec: r, lp: lp.Name, device: m.device}
+		*m.meter = tm
+		if me, ok := tm.Meter.(api.MeterEnergy); ok {
+			*m.meter = &traceEnergyMeter{traceMeter: tm, me: me}
+		}
+	}
+
+	if cs, ok := lp.Vehicle.(api.ChargeState); ok {
+		lp.Vehicle = &traceVehicle{Vehicle: lp.Vehicle, cs: cs, rec: r, lp: lp.Name}
+	}
+}
+
+// traced is implemented by recording device wrappers
+type traced interface {
+	tracedDevice() interface{}
+}
+
+// Untraced returns the device wrapped by a recorder. Reads outside of update
+// cycles, e.g. publishing live values concurrently to Update, must not be
+// recorded as replay assigns readings to cycles by their position.
+func Untraced(device interface{}) interface{} {
+	if t, ok := device.(traced); ok {
+		return t.tracedDevice()
+	}
+	return device
+}
+
+// traceCharger records charger access. Heartbeat and Close are passed to
+// the charger if supported.
+type traceCharger struct {
+	api.Charger
+	rec *Recorder
+	lp  string
+}
+
+func (c *traceCharger) Status() (api.ChargeStatus, error) {
+	res, err := c.Charger.Status()
+	c.rec.record(c.lp, "charger", opStatus, res, err)
+	return res, err
+}
+
+func (c *traceCharger) Enabled() (bool, error) {
+	res, err := c.Charger.Enabled()
+	c.rec.record(c.lp, "charger", opEnabled, res, err)
+	return res, err
+}
+
+func (c *traceCharger) Enable(enable bool) error {
+	err := c.Charger.Enable(enable)
+	c.rec.record(c.lp, "charger", opEnable, enable, err)
+	return err
+}
+
+func (c *traceCharger) ActualCurrent() (int64, error) {
+	res, err := c.Charger.ActualCurrent()
+	c.rec.record(c.lp, "charger", opActualCurrent, res, err)
+	return res, err
+}
+
+func (c *traceCharger) tracedDevice() interface{} {
+	return c.Charger
+}
+
+func (c *traceCharger) Heartbeat() error {
+	if hb, ok := c.Charger.(api.Heartbeat); ok {
+		return hb.Heartbeat()
+	}
+	return nil
+}
+
+func (c *traceCharger) Close() error {
+	if cl, ok := c.Charger.(io.Closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
+
+// traceController records charger access including current changes
+type traceController struct {
+	*traceCharger
+	cc api.ChargeController
+}
+
+func (c *traceController) MaxCurrent(current int64) error {
+	err := c.cc.MaxCurrent(current)
+	c.rec.record(c.lp, "charger", opMaxCurrent, current, err)
+	return err
+}
+
+// traceLimitedController is a traceController with supported current range
+type traceLimitedController struct {
+	*traceController
+}
+
+func (c *traceLimitedController) CurrentLimits() (int64, int64) {
+	return c.Charger.(api.CurrentLimiter).CurrentLimits()
+}
+
+// traceMeter records meter readings
+type traceMeter struct {
+	api.Meter
+	rec        *Recorder
+	lp, device string
+}
+
+func (m *traceMeter) tracedDevice() interface{} {
+	return m.Meter
+}
+
+func (m *traceMeter) CurrentPower() (float64, error) {
+	res, err := m.Meter.CurrentPower()
+	m.rec.record(m.lp, m.device, opPower, res, err)
+	return res, err
+}
+
+// traceEnergyMeter records meter readings including energy
+type traceEnergyMeter struct {
+	*traceMeter
+	me api.MeterEnergy
+}
+
+func (m *traceEnergyMeter) TotalEnergy() (float64, error) {
+	res, err := m.me.TotalEnergy()
+	m.rec.record(m.lp, m.device, opEnergy, res, err)
+	return res, err
+}
+
+// traceVehicle records vehicle state of charge readings
+type traceVehicle struct {
+	api.Vehicle
+	cs  api.ChargeState
+	rec *Recorder
+	lp  string
+}
+
+func (v *traceVehicle) tracedDevice() interface{} {
+	return v.Vehicle
+}
+
+func (v *traceVehicle) ChargeState() (float64, error) {
+	res, err := v.cs.ChargeState()
+	v.rec.record(v.lp, "vehicle", opSoC, res, err)
+	return res, err
+}
@@ -0,0 +1,26 @@
+package core
+
+import (
+	"github.com/andig/evcc/api"
+)
+
+type Vehicle struct {
+	title    string
+	capacity int64
+}
+
+// NewVehicle creates a new vehicle with battery capacity in kWh
+func NewVehicle(title string, capacity int64) api.Vehicle {
+	return &Vehicle{
+		title:    title,
+		capacity: capacity,
+	}
+}
+
+func (m *Vehicle) Title() string {
+	return m.title
+}
+
+func (m *Vehicle) Capacity() int64 {
+	return m.capacity
+}
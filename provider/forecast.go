@@ -0,0 +1,173 @@
+package provider
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andig/evcc/api"
+)
+
+const (
+	forecastCache    = 15 * time.Minute
+	forecastFileTime = "2006-01-02 15:04:05"
+)
+
+// ForecastSolar provides pv production forecasts from an HTTP endpoint
+// returning forecast.solar-style JSON:
+//
+//	{"result": {"watts": {"2019-10-26 08:00:00": 120, "2019-10-26 09:00:00": 850}}}
+//
+// Timestamps are local time. Each value is the power at the start of a slot
+// lasting until the next timestamp.
+type ForecastSolar struct {
+	*rateCache
+	client *http.Client
+	uri    string
+}
+
+type forecastSolarJSON struct {
+	Result struct {
+		Watts map[string]float64 `json:"watts"`
+	} `json:"result"`
+}
+
+// NewForecastSolar creates a forecast.solar pv forecast
+func NewForecastSolar(uri string) api.Forecast {
+	f := &ForecastSolar{
+		client: &http.Client{Timeout: 10 * time.Second},
+		uri:    uri,
+	}
+	f.rateCache = newRateCache("forecast", forecastCache, f.fetch)
+	return f
+}
+
+func (f *ForecastSolar) fetch() ([]api.Rate, error) {
+	var res forecastSolarJSON
+	if err := getJSON(f.client, f.uri, &res); err != nil {
+		return nil, fmt.Errorf("forecast: %v", err)
+	}
+
+	var points []forecastPoint
+	for k, v := range res.Result.Watts {
+		ts, err := time.ParseInLocation(forecastFileTime, k, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("forecast: %v", err)
+		}
+		points = append(points, forecastPoint{ts, v})
+	}
+
+	return forecastSlots(points), nil
+}
+
+// ForecastFile provides pv production forecasts from a CSV file with
+// timestamp and power in W per line, e.g. written by an external script:
+//
+//	2019-10-26T08:00:00+02:00,120
+//
+// Timestamps are RFC3339 or local time as 2006-01-02 15:04:05. A header
+// line is ignored.
+type ForecastFile struct {
+	*rateCache
+	file string
+}
+
+// NewForecastFile creates a pv forecast read from CSV file
+func NewForecastFile(file string) api.Forecast {
+	f := &ForecastFile{file: file}
+	f.rateCache = newRateCache("forecast", time.Minute, f.fetch)
+	return f
+}
+
+func (f *ForecastFile) fetch() ([]api.Rate, error) {
+	file, err := os.Open(f.file)
+	if err != nil {
+		return nil, fmt.Errorf("forecast: %v", err)
+	}
+	defer file.Close()
+
+	points, err := parseForecastCSV(file)
+	if err != nil {
+		return nil, fmt.Errorf("forecast: %v", err)
+	}
+
+	return forecastSlots(points), nil
+}
+
+func parseForecastTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if ts, err := time.Parse(time.RFC3339, s); err == nil {
+		return ts, nil
+	}
+	return time.ParseInLocation(forecastFileTime, s, time.Local)
+}
+
+func parseForecastCSV(r io.Reader) ([]forecastPoint, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+
+	var points []forecastPoint
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ts, err := parseForecastTime(rec[0])
+		if err != nil {
+			if line == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		power, err := strconv.ParseFloat(strings.TrimSpace(rec[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		points = append(points, forecastPoint{ts, power})
+	}
+
+	return points, nil
+}
+
+type forecastPoint struct {
+	ts    time.Time
+	power float64
+}
+
+// forecastSlots converts points into slots lasting until the next point.
+// The last slot lasts as long as the previous one.
+func forecastSlots(points []forecastPoint) []api.Rate {
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].ts.Before(points[j].ts)
+	})
+
+	rates := make([]api.Rate, 0, len(points))
+	for i, p := range points {
+		var end time.Time
+		switch {
+		case i+1 < len(points):
+			end = points[i+1].ts
+		case i > 0:
+			end = p.ts.Add(p.ts.Sub(points[i-1].ts))
+		default:
+			end = p.ts.Add(time.Hour)
+		}
+
+		rates = append(rates, api.Rate{Start: p.ts, End: end, Value: p.power})
+	}
+
+	return rates
+}
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForecastSolar(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"result":{
+			"watts":{"2019-10-26 09:00:00":850,"2019-10-26 08:00:00":120,"2019-10-26 10:00:00":1500},
+			"watt_hours":{"2019-10-26 08:00:00":0}
+		},"message":{"code":0}}`)
+	}))
+	defer srv.Close()
+
+	rates, err := NewForecastSolar(srv.URL).Rates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rates) != 3 {
+		t.Fatalf("unexpected rates %v", rates)
+	}
+
+	start := time.Date(2019, 10, 26, 8, 0, 0, 0, time.Local)
+	for i, power := range []float64{120, 850, 1500} {
+		r := rates[i]
+		ts := start.Add(time.Duration(i) * time.Hour)
+		if !r.Start.Equal(ts) || !r.End.Equal(ts.Add(time.Hour)) || r.Value != power {
+			t.Errorf("unexpected slot %d: %v", i, r)
+		}
+	}
+}
+
+func TestForecastCSV(t *testing.T) {
+	points, err := parseForecastCSV(strings.NewReader("time,power\n" +
+		"2019-10-26T08:00:00Z,120\n" +
+		"2019-10-26 09:30:00, 850\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(points) != 2 || points[0].power != 120 || points[1].power != 850 {
+		t.Fatalf("unexpected points %v", points)
+	}
+	if !points[0].ts.Equal(time.Date(2019, 10, 26, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time %v", points[0].ts)
+	}
+
+	if _, err := parseForecastCSV(strings.NewReader("2019-10-26T08:00:00Z,120\nnoon,850\n")); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestForecastFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "forecast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	fmt.Fprint(file, "2019-10-26T09:00:00Z,850\n2019-10-26T08:30:00Z,120\n")
+	file.Close()
+
+	rates, err := NewForecastFile(file.Name()).Rates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sorted and last slot as long as previous
+	start := time.Date(2019, 10, 26, 8, 30, 0, 0, time.UTC)
+	if len(rates) != 2 || !rates[0].Start.Equal(start) || !rates[1].End.Equal(start.Add(time.Hour)) {
+		t.Errorf("unexpected rates %v", rates)
+	}
+
+	if _, err := NewForecastFile(file.Name() + ".missing").Rates(); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/andig/evcc/api"
+)
+
+const carbonIntensityCache = 30 * time.Minute
+
+// CarbonIntensity provides CO2 intensity forecasts in g/kWh from an HTTP
+// endpoint returning carbonintensity.org.uk-style JSON:
+//
+//	{"data": [{"from": "2019-10-20T12:00Z", "to": "2019-10-20T12:30Z", "intensity": {"forecast": 266}}]}
+type CarbonIntensity struct {
+	*rateCache
+	client *http.Client
+	uri    string
+}
+
+type carbonIntensityJSON struct {
+	Data []struct {
+		From      string `json:"from"`
+		To        string `json:"to"`
+		Intensity struct {
+			Forecast float64 `json:"forecast"`
+		} `json:"intensity"`
+	} `json:"data"`
+}
+
+// NewCarbonIntensity creates a CO2 intensity forecast source
+func NewCarbonIntensity(uri string) api.Intensity {
+	t := &CarbonIntensity{
+		client: &http.Client{Timeout: 10 * time.Second},
+		uri:    uri,
+	}
+	t.rateCache = newRateCache("intensity", carbonIntensityCache, t.fetch)
+	return t
+}
+
+// parseIntensityTime parses minute-precision timestamps as used by
+// carbonintensity.org.uk with RFC3339 as fallback
+func parseIntensityTime(s string) (time.Time, error) {
+	if ts, err := time.Parse("2006-01-02T15:04Z", s); err == nil {
+		return ts, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func (t *CarbonIntensity) fetch() ([]api.Rate, error) {
+	var res carbonIntensityJSON
+	if err := getJSON(t.client, t.uri, &res); err != nil {
+		return nil, fmt.Errorf("intensity: %v", err)
+	}
+
+	rates := make([]api.Rate, 0, len(res.Data))
+	for _, r := range res.Data {
+		from, err := parseIntensityTime(r.From)
+		if err != nil {
+			return nil, fmt.Errorf("intensity: %v", err)
+		}
+
+		to, err := parseIntensityTime(r.To)
+		if err != nil {
+			return nil, fmt.Errorf("intensity: %v", err)
+		}
+
+		rates = append(rates, api.Rate{
+			Start: from,
+			End:   to,
+			Value: r.Intensity.Forecast,
+		})
+	}
+
+	return rates, nil
+}
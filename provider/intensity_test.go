@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCarbonIntensity(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":[
+			{"from":"2019-10-20T12:30Z","to":"2019-10-20T13:00Z","intensity":{"forecast":180,"actual":null,"index":"low"}},
+			{"from":"2019-10-20T12:00:00Z","to":"2019-10-20T12:30:00+00:00","intensity":{"forecast":266,"actual":263,"index":"moderate"}}
+		]}`)
+	}))
+	defer srv.Close()
+
+	rates, err := NewCarbonIntensity(srv.URL).Rates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rates) != 2 {
+		t.Fatalf("unexpected rates %v", rates)
+	}
+
+	start := time.Date(2019, 10, 20, 12, 0, 0, 0, time.UTC)
+	if !rates[0].Start.Equal(start) || !rates[0].End.Equal(start.Add(30*time.Minute)) || rates[0].Value != 266 {
+		t.Errorf("unexpected slot %v", rates[0])
+	}
+	if rates[1].Value != 180 {
+		t.Errorf("expected forecast 180, got %f", rates[1].Value)
+	}
+}
+
+func TestCarbonIntensityInvalidTime(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":[{"from":"noon","to":"2019-10-20T13:00Z","intensity":{"forecast":180}}]}`)
+	}))
+	defer srv.Close()
+
+	if _, err := NewCarbonIntensity(srv.URL).Rates(); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/andig/evcc/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	readDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "evcc",
+		Name:      "provider_read_duration_seconds",
+		Help:      "Duration of device reads",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"device"})
+
+	readErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "evcc",
+		Name:      "device_read_errors_total",
+		Help:      "Number of failed device reads",
+	}, []string{"device"})
+)
+
+func init() {
+	prometheus.MustRegister(readDuration, readErrors)
+}
+
+// observe records duration and result of a device read
+func observe(device string, start time.Time, err error) {
+	readDuration.WithLabelValues(device).Observe(time.Since(start).Seconds())
+	if err != nil {
+		readErrors.WithLabelValues(device).Inc()
+	}
+}
+
+// MeasuredFloatProvider records read duration and errors of provider
+func MeasuredFloatProvider(device string, p api.FloatProvider) api.FloatProvider {
+	return func(ctx context.Context) (float64, error) {
+		start := time.Now()
+		f, err := p(ctx)
+		observe(device, start, err)
+		return f, err
+	}
+}
+
+// MeasuredIntProvider records read duration and errors of provider
+func MeasuredIntProvider(device string, p api.IntProvider) api.IntProvider {
+	return func(ctx context.Context) (int64, error) {
+		start := time.Now()
+		i, err := p(ctx)
+		observe(device, start, err)
+		return i, err
+	}
+}
+
+// MeasuredStringProvider records read duration and errors of provider
+func MeasuredStringProvider(device string, p api.StringProvider) api.StringProvider {
+	return func(ctx context.Context) (string, error) {
+		start := time.Now()
+		s, err := p(ctx)
+		observe(device, start, err)
+		return s, err
+	}
+}
+
+// MeasuredBoolProvider records read duration and errors of provider
+func MeasuredBoolProvider(device string, p api.BoolProvider) api.BoolProvider {
+	return func(ctx context.Context) (bool, error) {
+		start := time.Now()
+		b, err := p(ctx)
+		observe(device, start, err)
+		return b, err
+	}
+}
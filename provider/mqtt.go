@@ -55,6 +55,12 @@ func NewMqttClient(
 	}
 }
 
+// Close disconnects from the broker, waiting for pending work
+func (m *MqttClient) Close() error {
+	m.Client.Disconnect(uint(publishTimeout / time.Millisecond))
+	return nil
+}
+
 // Listen listens to topic and relays to publisher
 func (m *MqttClient) Listen(topic string, callback func(string)) {
 	token := m.Client.Subscribe(topic, m.qos, func(c mqtt.Client, msg mqtt.Message) {
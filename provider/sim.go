@@ -0,0 +1,317 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/andig/evcc/api"
+)
+
+// SimConfig configures a simulated site with pv generator, house base load
+// and a vehicle at the charger
+type SimConfig struct {
+	Speed      float64   // simulated time passes faster, e.g. 60 for one hour per minute
+	BaseLoad   float64   // W, house consumption
+	PV         []float64 // W, pv generation per hour of day, interpolated
+	Capacity   float64   // kWh, vehicle battery
+	SoC        float64   // %, vehicle state of charge on arrival
+	MaxCurrent int64     // A, max current accepted by vehicle
+	Taper      float64   // %, state of charge above which accepted current decreases linearly
+	Voltage    float64   // V
+	Phases     float64
+	Arrival    string // 15:04, vehicle plugged in from, always plugged if empty
+	Departure  string // 15:04, vehicle plugged in until
+}
+
+// withDefaults returns config with unset values replaced by defaults
+func (c SimConfig) withDefaults() SimConfig {
+	if c.Speed <= 0 {
+		c.Speed = 1
+	}
+	if c.PV == nil {
+		// 5kWp on a sunny day
+		c.PV = make([]float64, 24)
+		for h := 6; h < 21; h++ {
+			c.PV[h] = math.Round(5000 * math.Sin(math.Pi*float64(h-6)/14))
+		}
+	}
+	if c.Capacity <= 0 {
+		c.Capacity = 50
+	}
+	if c.SoC <= 0 {
+		c.SoC = 20
+	}
+	if c.MaxCurrent <= 0 {
+		c.MaxCurrent = 16
+	}
+	if c.Taper <= 0 {
+		c.Taper = 80
+	}
+	if c.Voltage <= 0 {
+		c.Voltage = 230
+	}
+	if c.Phases <= 0 {
+		c.Phases = 1
+	}
+	return c
+}
+
+// Sim is a simulated site. Grid power follows the charge current set by the
+// charge controller, pv generation and base load. Simulated time starts at
+// creation and passes Speed times faster than wall clock.
+type Sim struct {
+	sync.Mutex
+	conf               SimConfig
+	clock              func() time.Time
+	started            time.Time     // wall clock at start
+	updated            time.Time     // simulated time of last update
+	schedule           bool          // vehicle plugged by arrival and departure
+	arrival, departure time.Duration // since midnight
+	plugged            bool
+	enabled            bool
+	current            int64   // A, max current set by charge controller
+	soc                float64 // %
+	energy             float64 // Wh, charged in total
+}
+
+// NewSim creates a simulated site
+func NewSim(conf SimConfig) (*Sim, error) {
+	return newSim(conf, time.Now)
+}
+
+func newSim(conf SimConfig, clock func() time.Time) (*Sim, error) {
+	s := &Sim{
+		conf:    conf.withDefaults(),
+		clock:   clock,
+		started: clock(),
+		enabled: true,
+	}
+
+	if len(s.conf.PV) != 24 {
+		return nil, errors.New("sim: pv requires 24 hourly values")
+	}
+	if s.conf.SoC > 100 || s.conf.Taper > 100 {
+		return nil, errors.New("sim: invalid soc")
+	}
+
+	if conf.Arrival != "" || conf.Departure != "" {
+		var err error
+		if s.arrival, err = api.ParseTimeOfDay(conf.Arrival); err != nil {
+			return nil, fmt.Errorf("sim: %v", err)
+		}
+		if s.departure, err = api.ParseTimeOfDay(conf.Departure); err != nil {
+			return nil, fmt.Errorf("sim: %v", err)
+		}
+		s.schedule = true
+	}
+
+	s.updated = s.started
+	s.soc = s.conf.SoC
+	s.plugged = s.pluggedAt(s.updated)
+
+	return s, nil
+}
+
+// now returns the simulated time
+func (s *Sim) now() time.Time {
+	elapsed := s.clock().Sub(s.started)
+	return s.started.Add(time.Duration(float64(elapsed) * s.conf.Speed))
+}
+
+// sinceMidnight returns the time of day
+func sinceMidnight(ts time.Time) time.Duration {
+	y, m, d := ts.Date()
+	return ts.Sub(time.Date(y, m, d, 0, 0, 0, 0, ts.Location()))
+}
+
+// pluggedAt returns if the vehicle is plugged at given time
+func (s *Sim) pluggedAt(ts time.Time) bool {
+	if !s.schedule {
+		return true
+	}
+
+	tod := sinceMidnight(ts)
+	if s.arrival <= s.departure {
+		return tod >= s.arrival && tod < s.departure
+	}
+	return tod >= s.arrival || tod < s.departure
+}
+
+// update integrates charged energy since the last update and plugs or
+// unplugs the vehicle. A newly arriving vehicle has the configured soc.
+func (s *Sim) update() {
+	ts := s.now()
+
+	if hours := ts.Sub(s.updated).Hours(); hours > 0 {
+		energy := s.chargePower() * hours
+		s.energy += energy
+		s.soc = math.Min(100, s.soc+energy/s.conf.Capacity/10)
+	}
+	s.updated = ts
+
+	plugged := s.pluggedAt(ts)
+	if plugged && !s.plugged {
+		s.soc = s.conf.SoC
+	}
+	s.plugged = plugged
+}
+
+// chargeCurrent is the current drawn by the vehicle, limited by the charge
+// controller and the vehicle's charge curve
+func (s *Sim) chargeCurrent() int64 {
+	if !s.plugged || !s.enabled {
+		return 0
+	}
+
+	accepted := s.conf.MaxCurrent
+	if s.soc >= 100 {
+		accepted = 0
+	} else if s.soc > s.conf.Taper {
+		accepted = int64(float64(s.conf.MaxCurrent) * (100 - s.soc) / (100 - s.conf.Taper))
+	}
+
+	if s.current < accepted {
+		return s.current
+	}
+	return accepted
+}
+
+func (s *Sim) chargePower() float64 {
+	return float64(s.chargeCurrent()) * s.conf.Voltage * s.conf.Phases
+}
+
+func (s *Sim) pvPower() float64 {
+	h := sinceMidnight(s.updated).Hours()
+	i := int(h)
+	from, to := s.conf.PV[i%24], s.conf.PV[(i+1)%24]
+	return from + (to-from)*(h-float64(i))
+}
+
+// locked returns fn applied to the updated simulation
+func (s *Sim) locked(fn func() float64) func() float64 {
+	return func() float64 {
+		s.Lock()
+		defer s.Unlock()
+		s.update()
+		return fn()
+	}
+}
+
+// Status implements the Charger.Status interface
+func (s *Sim) Status() (api.ChargeStatus, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.update()
+
+	switch {
+	case !s.plugged:
+		return api.StatusA, nil
+	case s.chargeCurrent() > 0:
+		return api.StatusC, nil
+	default:
+		return api.StatusB, nil
+	}
+}
+
+// Enabled implements the Charger.Enabled interface
+func (s *Sim) Enabled() (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.enabled, nil
+}
+
+// Enable implements the Charger.Enable interface
+func (s *Sim) Enable(enable bool) error {
+	s.Lock()
+	defer s.Unlock()
+	s.update()
+	s.enabled = enable
+	return nil
+}
+
+// ActualCurrent implements the Charger.ActualCurrent interface
+func (s *Sim) ActualCurrent() (int64, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.update()
+	return s.chargeCurrent(), nil
+}
+
+// MaxCurrent implements the ChargeController.MaxCurrent interface
+func (s *Sim) MaxCurrent(current int64) error {
+	s.Lock()
+	defer s.Unlock()
+	s.update()
+	s.current = current
+	return nil
+}
+
+// simMeter reads power and energy from the simulation
+type simMeter struct {
+	power  func() float64
+	energy func() float64
+}
+
+func (m *simMeter) CurrentPower() (float64, error) {
+	return m.power(), nil
+}
+
+// simEnergyMeter is a simulated meter measuring energy
+type simEnergyMeter struct {
+	*simMeter
+}
+
+func (m *simEnergyMeter) TotalEnergy() (float64, error) {
+	return m.energy(), nil
+}
+
+// GridMeter returns a meter measuring base load and charge power reduced by
+// pv generation
+func (s *Sim) GridMeter() api.Meter {
+	return &simMeter{power: s.locked(func() float64 {
+		return s.conf.BaseLoad + s.chargePower() - s.pvPower()
+	})}
+}
+
+// PVMeter returns a meter measuring pv generation
+func (s *Sim) PVMeter() api.Meter {
+	return &simMeter{power: s.locked(s.pvPower)}
+}
+
+// ChargeMeter returns a meter measuring charge power and energy
+func (s *Sim) ChargeMeter() api.Meter {
+	return &simEnergyMeter{&simMeter{
+		power:  s.locked(s.chargePower),
+		energy: s.locked(func() float64 { return s.energy }),
+	}}
+}
+
+// simVehicle is the simulated vehicle
+type simVehicle struct {
+	sim   *Sim
+	title string
+}
+
+// Vehicle returns the simulated vehicle
+func (s *Sim) Vehicle(title string) api.Vehicle {
+	return &simVehicle{sim: s, title: title}
+}
+
+func (v *simVehicle) Title() string {
+	return v.title
+}
+
+func (v *simVehicle) Capacity() int64 {
+	return int64(v.sim.conf.Capacity)
+}
+
+// ChargeState implements the ChargeState interface
+func (v *simVehicle) ChargeState() (float64, error) {
+	v.sim.Lock()
+	defer v.sim.Unlock()
+	v.sim.update()
+	return v.sim.soc, nil
+}
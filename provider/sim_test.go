@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andig/evcc/api"
+)
+
+func TestSim(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.Local)
+	clock := func() time.Time { return now }
+
+	pv := make([]float64, 24)
+	pv[12], pv[13] = 4000, 2000
+
+	s, err := newSim(SimConfig{
+		PV:       pv,
+		BaseLoad: 500,
+		Capacity: 10,
+		SoC:      50,
+		Taper:    75,
+	}, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grid, charge := s.GridMeter(), s.ChargeMeter()
+
+	if p, _ := grid.CurrentPower(); p != -3500 {
+		t.Errorf("expected grid power -3500W, got %.0fW", p)
+	}
+	if status, _ := s.Status(); status != api.StatusB {
+		t.Errorf("expected status B, got %s", status)
+	}
+
+	// grid power follows charge current
+	_ = s.MaxCurrent(10)
+	if status, _ := s.Status(); status != api.StatusC {
+		t.Errorf("expected status C, got %s", status)
+	}
+	if p, _ := grid.CurrentPower(); p != -1200 {
+		t.Errorf("expected grid power -1200W, got %.0fW", p)
+	}
+
+	// pv is interpolated, charged energy raises soc
+	now = now.Add(30 * time.Minute)
+	if p, _ := s.PVMeter().CurrentPower(); p != 3000 {
+		t.Errorf("expected pv power 3000W, got %.0fW", p)
+	}
+	if e, _ := charge.(api.MeterEnergy).TotalEnergy(); e != 1150 {
+		t.Errorf("expected charged energy 1150Wh, got %.0fWh", e)
+	}
+	if soc, _ := s.Vehicle("car").(api.ChargeState).ChargeState(); soc != 61.5 {
+		t.Errorf("expected soc 61.5%%, got %.1f%%", soc)
+	}
+
+	// accepted current decreases above taper soc
+	_ = s.MaxCurrent(16)
+	now = now.Add(30 * time.Minute)
+	if i, _ := s.ActualCurrent(); i != 12 {
+		t.Errorf("expected tapered current 12A, got %dA", i)
+	}
+
+	// disabled charger draws no current
+	_ = s.Enable(false)
+	if i, _ := s.ActualCurrent(); i != 0 {
+		t.Errorf("expected no current, got %dA", i)
+	}
+}
+
+func TestSimPlugged(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.Local)
+	clock := func() time.Time { return now }
+
+	s, err := newSim(SimConfig{Arrival: "17:00", Departure: "07:00", SoC: 30, Speed: 60}, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.MaxCurrent(16)
+
+	if status, _ := s.Status(); status != api.StatusA {
+		t.Errorf("expected status A, got %s", status)
+	}
+
+	// 6 simulated hours later
+	now = now.Add(6 * time.Minute)
+	if status, _ := s.Status(); status != api.StatusC {
+		t.Errorf("expected status C, got %s", status)
+	}
+	if soc, _ := s.Vehicle("car").(api.ChargeState).ChargeState(); soc != 30 {
+		t.Errorf("expected arrival soc 30%%, got %.1f%%", soc)
+	}
+
+	if _, err := newSim(SimConfig{Arrival: "17:00"}, clock); err == nil {
+		t.Error("expected missing departure error")
+	}
+	if _, err := newSim(SimConfig{PV: []float64{1000}}, clock); err == nil {
+		t.Error("expected invalid pv profile error")
+	}
+}
@@ -0,0 +1,276 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/andig/evcc/api"
+)
+
+const (
+	dayAheadCache  = time.Hour
+	rateCacheRetry = time.Minute // fetch retry after failure
+	timeOfUseSlot  = 15 * time.Minute
+)
+
+// DayAhead provides day-ahead market prices from an HTTP endpoint returning
+// awattar-style JSON:
+//
+//	{"data": [{"start_timestamp": 1571864400000, "end_timestamp": 1571868000000, "marketprice": 32.5}]}
+//
+// Timestamps are in ms, market prices per MWh. Markup per kWh is added to the
+// market price to account for grid fees and taxes.
+type DayAhead struct {
+	*rateCache
+	client *http.Client
+	uri    string
+	markup float64
+}
+
+type dayAheadJSON struct {
+	Data []struct {
+		StartTimestamp int64   `json:"start_timestamp"`
+		EndTimestamp   int64   `json:"end_timestamp"`
+		Marketprice    float64 `json:"marketprice"`
+	} `json:"data"`
+}
+
+// NewDayAhead creates a day-ahead price tariff
+func NewDayAhead(uri string, markup float64) api.Tariff {
+	t := &DayAhead{
+		client: &http.Client{Timeout: 10 * time.Second},
+		uri:    uri,
+		markup: markup,
+	}
+	t.rateCache = newRateCache("dayahead", dayAheadCache, t.fetch)
+	return t
+}
+
+func msToTime(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+func (t *DayAhead) fetch() ([]api.Rate, error) {
+	var res dayAheadJSON
+	if err := getJSON(t.client, t.uri, &res); err != nil {
+		return nil, fmt.Errorf("dayahead: %v", err)
+	}
+
+	rates := make([]api.Rate, 0, len(res.Data))
+	for _, r := range res.Data {
+		rates = append(rates, api.Rate{
+			Start: msToTime(r.StartTimestamp),
+			End:   msToTime(r.EndTimestamp),
+			Value: r.Marketprice/1e3 + t.markup,
+		})
+	}
+
+	return rates, nil
+}
+
+// rateCache caches rates returned by fetch
+type rateCache struct {
+	device string // metrics label
+	ttl    time.Duration
+	fetch  func() ([]api.Rate, error)
+
+	mux      sync.Mutex
+	updated  time.Time
+	rates    []api.Rate
+	retry    time.Time     // earliest fetch after failure
+	err      error         // last fetch error
+	updating chan struct{} // closed when the running update completes
+}
+
+func newRateCache(device string, ttl time.Duration, fetch func() ([]api.Rate, error)) *rateCache {
+	return &rateCache{
+		device: device,
+		ttl:    ttl,
+		fetch:  fetch,
+	}
+}
+
+// Rates returns the cached rates sorted by start, updated in background after
+// ttl. Until the update completes or if it fails, cached rates not yet ended
+// are returned. Only the very first update is waited for.
+func (c *rateCache) Rates() ([]api.Rate, error) {
+	c.mux.Lock()
+
+	now := time.Now()
+	if now.Sub(c.updated) < c.ttl {
+		defer c.mux.Unlock()
+		return c.rates, nil
+	}
+
+	if c.updating == nil && !now.Before(c.retry) {
+		c.updating = make(chan struct{})
+		go c.update(c.updating)
+	}
+
+	updating := c.updating
+	initial := c.updated.IsZero() && c.err == nil
+	c.mux.Unlock()
+
+	if initial && updating != nil {
+		<-updating
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	now = time.Now()
+	if now.Sub(c.updated) < c.ttl {
+		return c.rates, nil
+	}
+
+	return c.remaining(now)
+}
+
+// update fetches the rates without blocking readers of the cached rates
+func (c *rateCache) update(done chan struct{}) {
+	start := time.Now()
+	rates, err := c.fetch()
+	observe(c.device, start, err)
+
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Start.Before(rates[j].Start)
+	})
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	defer close(done)
+
+	c.updating = nil
+
+	if err != nil {
+		log.Printf("%v, retry in %v", err, rateCacheRetry)
+		c.err = err
+		c.retry = time.Now().Add(rateCacheRetry)
+		return
+	}
+
+	c.rates = rates
+	c.updated = time.Now()
+	c.retry = time.Time{}
+}
+
+// remaining returns the cached rates not ended at ts or the last fetch error
+// if there are none
+func (c *rateCache) remaining(ts time.Time) ([]api.Rate, error) {
+	var rates []api.Rate
+	for _, r := range c.rates {
+		if r.End.After(ts) {
+			rates = append(rates, r)
+		}
+	}
+
+	if len(rates) == 0 {
+		return nil, c.err
+	}
+
+	return rates, nil
+}
+
+// getJSON decodes the JSON response of uri into res
+func getJSON(client *http.Client, uri string, res interface{}) error {
+	resp, err := client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// TimeOfUseRate is the price of a daily time window. Windows may extend
+// over midnight.
+type TimeOfUseRate struct {
+	From  string // 15:04
+	To    string // 15:04
+	Price float64
+}
+
+type timeOfUseWindow struct {
+	from, to time.Duration // since midnight
+	price    float64
+}
+
+// TimeOfUse provides prices from a static daily schedule
+type TimeOfUse struct {
+	price   float64
+	windows []timeOfUseWindow
+}
+
+// NewTimeOfUse creates a time-of-use tariff with default price outside the given windows
+func NewTimeOfUse(price float64, rates []TimeOfUseRate) (api.Tariff, error) {
+	t := &TimeOfUse{price: price}
+
+	for _, r := range rates {
+		from, err := api.ParseTimeOfDay(r.From)
+		if err != nil {
+			return nil, err
+		}
+
+		to, err := api.ParseTimeOfDay(r.To)
+		if err != nil {
+			return nil, err
+		}
+
+		if from == to {
+			return nil, errors.New("time of use window must not be empty")
+		}
+
+		t.windows = append(t.windows, timeOfUseWindow{from: from, to: to, price: r.Price})
+	}
+
+	return t, nil
+}
+
+// priceAt returns the price at duration since midnight
+func (t *TimeOfUse) priceAt(d time.Duration) float64 {
+	for _, w := range t.windows {
+		if w.from < w.to && d >= w.from && d < w.to ||
+			w.from > w.to && (d >= w.from || d < w.to) {
+			return w.price
+		}
+	}
+	return t.price
+}
+
+// Rates returns prices for today and tomorrow in 15 minute slots
+func (t *TimeOfUse) Rates() ([]api.Rate, error) {
+	return t.rates(time.Now()), nil
+}
+
+// rates returns the slots of the day of ts and the following day. Days are
+// bounded by local midnight and slots priced by their local time of day, days
+// with daylight saving time changes have less or more slots.
+func (t *TimeOfUse) rates(ts time.Time) []api.Rate {
+	var rates []api.Rate
+	for day := 0; day < 2; day++ {
+		start := time.Date(ts.Year(), ts.Month(), ts.Day()+day, 0, 0, 0, 0, ts.Location())
+		end := time.Date(ts.Year(), ts.Month(), ts.Day()+day+1, 0, 0, 0, 0, ts.Location())
+
+		for slot := start; slot.Before(end); slot = slot.Add(timeOfUseSlot) {
+			d := time.Duration(slot.Hour())*time.Hour + time.Duration(slot.Minute())*time.Minute
+
+			rates = append(rates, api.Rate{
+				Start: slot,
+				End:   slot.Add(timeOfUseSlot),
+				Value: t.priceAt(d),
+			})
+		}
+	}
+
+	return rates
+}
@@ -0,0 +1,217 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andig/evcc/api"
+)
+
+func TestDayAhead(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"object":"list","data":[
+			{"start_timestamp":1571868000000,"end_timestamp":1571871600000,"marketprice":40.0,"unit":"Eur/MWh"},
+			{"start_timestamp":1571864400000,"end_timestamp":1571868000000,"marketprice":32.5,"unit":"Eur/MWh"}
+		]}`)
+	}))
+	defer srv.Close()
+
+	tariff := NewDayAhead(srv.URL, 0.2)
+
+	rates, err := tariff.Rates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rates) != 2 {
+		t.Fatalf("unexpected rates %v", rates)
+	}
+
+	// sorted by start
+	if !rates[0].Start.Equal(time.Unix(1571864400, 0)) || !rates[0].End.Equal(time.Unix(1571868000, 0)) {
+		t.Errorf("unexpected slot %v", rates[0])
+	}
+	if math.Abs(rates[0].Value-0.2325) > 1e-9 {
+		t.Errorf("expected price 0.2325, got %f", rates[0].Value)
+	}
+
+	// cached
+	if _, err := tariff.Rates(); err != nil || requests != 1 {
+		t.Errorf("expected cached rates, got %d requests: %v", requests, err)
+	}
+}
+
+func TestDayAheadError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	if _, err := NewDayAhead(srv.URL, 0).Rates(); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestRateCacheError(t *testing.T) {
+	now := time.Now()
+	past := api.Rate{Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)}
+	future := api.Rate{Start: now.Add(-time.Hour), End: now.Add(time.Hour)}
+
+	fetched := 0
+	var fail error
+	c := &rateCache{ttl: time.Hour, fetch: func() ([]api.Rate, error) {
+		fetched++
+		return []api.Rate{past, future}, fail
+	}}
+
+	if _, err := c.Rates(); err != nil {
+		t.Fatal(err)
+	}
+
+	// expired, fetch failing
+	c.updated = now.Add(-2 * time.Hour)
+	fail = errors.New("unavailable")
+
+	rates, err := c.Rates()
+	if err != nil || len(rates) != 1 || rates[0] != future {
+		t.Errorf("expected cached future rate, got %v: %v", rates, err)
+	}
+	waitUpdate(c)
+
+	// no fetch before retry
+	if _, err := c.Rates(); err != nil || fetched != 2 {
+		t.Errorf("expected %d fetches, got %d: %v", 2, fetched, err)
+	}
+
+	// error without cached rates
+	c.rates, c.retry = nil, time.Time{}
+	if _, err := c.Rates(); err == nil {
+		t.Error("expected error")
+	}
+	if waitUpdate(c); fetched != 3 {
+		t.Errorf("expected %d fetches, got %d", 3, fetched)
+	}
+}
+
+// waitUpdate waits for the running background update
+func waitUpdate(c *rateCache) {
+	c.mux.Lock()
+	updating := c.updating
+	c.mux.Unlock()
+
+	if updating != nil {
+		<-updating
+	}
+}
+
+func TestRateCacheRefresh(t *testing.T) {
+	now := time.Now()
+	stale := api.Rate{Start: now, End: now.Add(time.Hour), Value: 1}
+	fresh := api.Rate{Start: now, End: now.Add(time.Hour), Value: 2}
+
+	release := make(chan struct{})
+	c := &rateCache{ttl: time.Hour, fetch: func() ([]api.Rate, error) {
+		<-release
+		return []api.Rate{fresh}, nil
+	}}
+	c.rates, c.updated = []api.Rate{stale}, now.Add(-2*time.Hour)
+
+	// stale rates served while fetching
+	rates, err := c.Rates()
+	if err != nil || len(rates) != 1 || rates[0] != stale {
+		t.Errorf("expected stale rate, got %v: %v", rates, err)
+	}
+
+	close(release)
+	waitUpdate(c)
+
+	if rates, err := c.Rates(); err != nil || len(rates) != 1 || rates[0] != fresh {
+		t.Errorf("expected fresh rate, got %v: %v", rates, err)
+	}
+}
+
+func TestTimeOfUse(t *testing.T) {
+	if _, err := NewTimeOfUse(0.3, []TimeOfUseRate{{From: "25:00", To: "06:00"}}); err == nil {
+		t.Error("expected invalid time error")
+	}
+
+	tariff, err := NewTimeOfUse(0.3, []TimeOfUseRate{
+		{From: "22:00", To: "06:00", Price: 0.2},
+		{From: "12:30", To: "13:00", Price: 0.25},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rates, err := tariff.Rates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rates) != 2*24*4 {
+		t.Fatalf("expected 2 days of 15 minute slots, got %d", len(rates))
+	}
+
+	for _, r := range rates {
+		expected := 0.3
+		switch h, m := r.Start.Hour(), r.Start.Minute(); {
+		case h >= 22 || h < 6:
+			expected = 0.2
+		case h == 12 && m >= 30:
+			expected = 0.25
+		}
+
+		if r.Value != expected {
+			t.Errorf("%v: expected price %.2f, got %.2f", r.Start, expected, r.Value)
+		}
+	}
+}
+
+func TestTimeOfUseDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	tariff, err := NewTimeOfUse(0.3, []TimeOfUseRate{{From: "02:00", To: "06:00", Price: 0.2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// clocks changed forward and back between 2:00 and 3:00
+	cases := []struct {
+		day   time.Time
+		hours int
+	}{
+		{time.Date(2020, 3, 29, 12, 0, 0, 0, loc), 23 + 24},
+		{time.Date(2020, 10, 25, 12, 0, 0, 0, loc), 25 + 24},
+	}
+
+	for _, c := range cases {
+		rates := tariff.(*TimeOfUse).rates(c.day)
+		if len(rates) != c.hours*4 {
+			t.Errorf("%v: expected %d slots, got %d", c.day, c.hours*4, len(rates))
+		}
+
+		for i, r := range rates {
+			if i > 0 && !r.Start.Equal(rates[i-1].End) {
+				t.Errorf("%v: slot not contiguous", r.Start)
+			}
+
+			expected := 0.3
+			if h := r.Start.Hour(); h >= 2 && h < 6 {
+				expected = 0.2
+			}
+			if r.Value != expected {
+				t.Errorf("%v: expected price %.2f, got %.2f", r.Start, expected, r.Value)
+			}
+		}
+	}
+}
@@ -2,6 +2,10 @@ package provider
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/andig/evcc/api"
@@ -11,14 +15,48 @@ import (
 const (
 	slaveID = 255
 	timeout = 1 * time.Second
+
+	wbMinCurrent = 6  // A, IEC 61851 minimum
+	wbMaxCurrent = 32 // A
+
+	wbMaxTimeout = math.MaxUint16 * time.Second // 16 bit register
 )
 
+// WallbeFailsafe configures the charge controller's failsafe. If the
+// controller doesn't receive a heartbeat within timeout, it falls back to the
+// failsafe current. Register addresses depend on the controller's firmware,
+// see its manual.
+type WallbeFailsafe struct {
+	Current         int64 // A
+	Timeout         time.Duration
+	CurrentRegister uint16 // holding register of failsafe current in A
+	TimeoutRegister uint16 // holding register of failsafe timeout in s, written as heartbeat
+}
+
 type Wallbe struct {
-	client modbus.Client
+	handler  *modbus.TCPClientHandler
+	client   modbus.Client
+	device   string // metrics label
+	failsafe *WallbeFailsafe
+
+	mux         sync.Mutex
+	failsafeSet bool // failsafe current written
 }
 
-// NewWallbe creates a Wallbe charger
-func NewWallbe(conn string) api.Charger {
+// NewWallbe creates a Wallbe charger. Failsafe is optional.
+func NewWallbe(conn string, failsafe *WallbeFailsafe) (api.Charger, error) {
+	if failsafe != nil {
+		if failsafe.Current < wbMinCurrent || failsafe.Current > wbMaxCurrent {
+			return nil, errors.New("wallbe: invalid failsafe current")
+		}
+		if failsafe.Timeout < time.Second || failsafe.CurrentRegister == 0 || failsafe.TimeoutRegister == 0 {
+			return nil, errors.New("wallbe: failsafe requires timeout and registers")
+		}
+		if failsafe.Timeout > wbMaxTimeout {
+			return nil, fmt.Errorf("wallbe: failsafe timeout exceeds %v", wbMaxTimeout)
+		}
+	}
+
 	handler := modbus.NewTCPClientHandler(conn)
 	client := modbus.NewClient(handler)
 
@@ -26,23 +64,66 @@ func NewWallbe(conn string) api.Charger {
 	handler.Timeout = timeout
 
 	return &Wallbe{
-		client: client,
+		handler:  handler,
+		client:   client,
+		device:   "wallbe " + conn,
+		failsafe: failsafe,
+	}, nil
+}
+
+// Heartbeat implements the Heartbeat interface. It refreshes the failsafe
+// timeout, writing the failsafe current first if not done before.
+func (m *Wallbe) Heartbeat() error {
+	if m.failsafe == nil {
+		return nil
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	// controller may have restarted, write until successful
+	if !m.failsafeSet {
+		start := time.Now()
+		_, err := m.client.WriteSingleRegister(m.failsafe.CurrentRegister, uint16(m.failsafe.Current))
+		observe(m.device, start, err)
+		if err != nil {
+			return err
+		}
+		m.failsafeSet = true
+	}
+
+	start := time.Now()
+	_, err := m.client.WriteSingleRegister(m.failsafe.TimeoutRegister, uint16(m.failsafe.Timeout/time.Second))
+	observe(m.device, start, err)
+	if err != nil {
+		m.failsafeSet = false
 	}
+
+	return err
+}
+
+// Close closes the modbus connection
+func (m *Wallbe) Close() error {
+	return m.handler.Close()
 }
 
 func (m *Wallbe) Status() (api.ChargeStatus, error) {
+	start := time.Now()
 	b, err := m.client.ReadInputRegisters(100, 1)
+	observe(m.device, start, err)
 	if err != nil {
-		return api.StatusNone, nil
+		return api.StatusNone, err
 	}
 
 	return api.ChargeStatus(string(b)), nil
 }
 
 func (m *Wallbe) ActualCurrent() (int64, error) {
+	start := time.Now()
 	b, err := m.client.ReadHoldingRegisters(300, 1)
+	observe(m.device, start, err)
 	if err != nil {
-		return 0, nil
+		return 0, err
 	}
 
 	u := binary.BigEndian.Uint16(b)
@@ -54,20 +135,27 @@ func (m *Wallbe) MaxCurrent(current int64) error {
 	return err
 }
 
+// CurrentLimits implements the CurrentLimiter interface
+func (m *Wallbe) CurrentLimits() (int64, int64) {
+	return wbMinCurrent, wbMaxCurrent
+}
+
 func (m *Wallbe) Enabled() (bool, error) {
+	start := time.Now()
 	b, err := m.client.ReadCoils(400, 1)
+	observe(m.device, start, err)
 	if err != nil {
-		return false, nil
+		return false, err
 	}
 
-	u := binary.BigEndian.Uint16(b)
-	return u == 1, nil
+	// single coil is returned as lowest bit of one byte
+	return len(b) > 0 && b[0]&1 == 1, nil
 }
 
 func (m *Wallbe) Enable(enable bool) error {
 	var u uint16
 	if enable {
-		u = 1
+		u = 0xFF00
 	}
 	_, err := m.client.WriteSingleCoil(400, u)
 	return err
@@ -1,15 +1,112 @@
 package provider
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/andig/evcc/api"
+	"github.com/grid-x/modbus"
 )
 
 func TestWallbe(t *testing.T) {
-	var c api.Charger = NewWallbe("192.168.0.8:502")
+	c, err := NewWallbe("192.168.0.8:502", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if _, ok := c.(api.ChargeController); !ok {
 		t.Error("not a charge controller")
 	}
+
+	if _, ok := c.(api.CurrentLimiter); !ok {
+		t.Error("not a current limiter")
+	}
+
+	if _, ok := c.(api.Heartbeat); !ok {
+		t.Error("not a heartbeat")
+	}
+}
+
+// testModbus records written registers and coils
+type testModbus struct {
+	modbus.Client
+	registers map[uint16]uint16
+	coils     map[uint16]uint16
+	err       error
+}
+
+func (m *testModbus) WriteSingleRegister(address, value uint16) ([]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.registers[address] = value
+	return nil, nil
+}
+
+func (m *testModbus) WriteSingleCoil(address, value uint16) ([]byte, error) {
+	m.coils[address] = value
+	return nil, nil
+}
+
+func (m *testModbus) ReadCoils(address, quantity uint16) ([]byte, error) {
+	if m.coils[address] == 0xFF00 {
+		return []byte{1}, nil
+	}
+	return []byte{0}, nil
+}
+
+func TestWallbeEnable(t *testing.T) {
+	client := &testModbus{coils: make(map[uint16]uint16)}
+	wb := &Wallbe{client: client}
+
+	for _, enable := range []bool{true, false} {
+		if err := wb.Enable(enable); err != nil {
+			t.Fatal(err)
+		}
+
+		if enabled, err := wb.Enabled(); err != nil || enabled != enable {
+			t.Errorf("expected enabled %v, got %v %v", enable, enabled, err)
+		}
+	}
+}
+
+func TestWallbeFailsafe(t *testing.T) {
+	if _, err := NewWallbe("192.168.0.8:502", &WallbeFailsafe{Current: 6}); err == nil {
+		t.Error("expected missing registers error")
+	}
+	if _, err := NewWallbe("192.168.0.8:502", &WallbeFailsafe{Current: 40, Timeout: time.Minute, CurrentRegister: 1, TimeoutRegister: 2}); err == nil {
+		t.Error("expected invalid current error")
+	}
+	if _, err := NewWallbe("192.168.0.8:502", &WallbeFailsafe{Current: 6, Timeout: 24 * time.Hour, CurrentRegister: 1, TimeoutRegister: 2}); err == nil {
+		t.Error("expected invalid timeout error")
+	}
+
+	client := &testModbus{registers: make(map[uint16]uint16)}
+	wb := &Wallbe{
+		client:   client,
+		failsafe: &WallbeFailsafe{Current: 6, Timeout: time.Minute, CurrentRegister: 1, TimeoutRegister: 2},
+	}
+
+	if err := wb.Heartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if client.registers[1] != 6 || client.registers[2] != 60 {
+		t.Errorf("unexpected registers %v", client.registers)
+	}
+
+	// failsafe current is written again after communication failure
+	client.err = errors.New("timeout")
+	if err := wb.Heartbeat(); err == nil {
+		t.Error("expected error")
+	}
+
+	client.err = nil
+	client.registers = make(map[uint16]uint16)
+	if err := wb.Heartbeat(); err != nil {
+		t.Fatal(err)
+	}
+	if client.registers[1] != 6 {
+		t.Errorf("expected failsafe current to be rewritten, got %v", client.registers)
+	}
 }
@@ -0,0 +1,394 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookie = "evcc_session"
+	sessionTTL    = 30 * 24 * time.Hour
+)
+
+// Role is the authorization level of a user or API token
+type Role string
+
+const (
+	RoleNone     Role = ""
+	RoleReadOnly Role = "readonly"
+	RoleAdmin    Role = "admin"
+)
+
+// allows checks if role is sufficient for required role
+func (r Role) allows(required Role) bool {
+	switch required {
+	case RoleNone:
+		return true
+	case RoleReadOnly:
+		return r == RoleReadOnly || r == RoleAdmin
+	default:
+		return r == RoleAdmin
+	}
+}
+
+// User is a password-authenticated user
+type User struct {
+	Name     string
+	Password string
+	Role     Role
+}
+
+// Token is an API token for scripts
+type Token struct {
+	Token string
+	Role  Role
+}
+
+type roleContextKey struct{}
+
+// RoleFromContext returns the role of the authenticated request
+func RoleFromContext(ctx context.Context) Role {
+	if role, ok := ctx.Value(roleContextKey{}).(Role); ok {
+		return role
+	}
+	return RoleNone
+}
+
+// Auth authenticates requests using session cookies or API tokens and
+// validates request origins. Authentication is disabled if neither users
+// nor tokens are configured.
+type Auth struct {
+	users   []User
+	tokens  []Token
+	origins []string
+	secret  []byte
+	secure  bool
+
+	mu      sync.Mutex
+	revoked map[string]time.Time // logged out sessions by signature until expiry
+}
+
+// NewAuth creates request authentication. Secure marks session cookies for HTTPS only.
+func NewAuth(users []User, tokens []Token, origins []string, secure bool) (*Auth, error) {
+	for _, u := range users {
+		if u.Name == "" || u.Password == "" {
+			return nil, errors.New("auth: user requires name and password")
+		}
+		if u.Role != RoleReadOnly && u.Role != RoleAdmin {
+			return nil, fmt.Errorf("auth: invalid role '%s' for user %s", u.Role, u.Name)
+		}
+	}
+
+	for _, t := range tokens {
+		if len(t.Token) < 16 {
+			return nil, errors.New("auth: token must have at least 16 characters")
+		}
+		if t.Role != RoleReadOnly && t.Role != RoleAdmin {
+			return nil, fmt.Errorf("auth: invalid token role '%s'", t.Role)
+		}
+	}
+
+	for _, o := range origins {
+		if _, err := url.Parse(o); err != nil {
+			return nil, fmt.Errorf("auth: invalid origin '%s'", o)
+		}
+	}
+
+	// sessions are invalidated on restart
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return &Auth{
+		users:   users,
+		tokens:  tokens,
+		origins: origins,
+		secret:  secret,
+		secure:  secure,
+		revoked: make(map[string]time.Time),
+	}, nil
+}
+
+// Enabled returns true if authentication is required
+func (a *Auth) Enabled() bool {
+	return a != nil && (len(a.users) > 0 || len(a.tokens) > 0)
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// sign creates HMAC signature of payload
+func (a *Auth) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	_, _ = mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// session creates signed session value. The nonce makes sessions of the same
+// user distinguishable for revocation.
+func (a *Auth) session(user User, expiry time.Time) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(
+		fmt.Sprintf("%s|%s|%d|%x", user.Name, user.Role, expiry.Unix(), nonce),
+	))
+	return payload + "." + a.sign(payload), nil
+}
+
+// sessionFields validates session value and returns user name and expiry
+func (a *Auth) sessionFields(value string) (string, time.Time, bool) {
+	segments := strings.Split(value, ".")
+	if len(segments) != 2 || !equal(a.sign(segments[0]), segments[1]) {
+		return "", time.Time{}, false
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(segments[0])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	fields := strings.Split(string(b), "|")
+	if len(fields) != 4 {
+		return "", time.Time{}, false
+	}
+
+	expiry, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || time.Now().After(time.Unix(expiry, 0)) {
+		return "", time.Time{}, false
+	}
+
+	a.mu.Lock()
+	_, revoked := a.revoked[segments[1]]
+	a.mu.Unlock()
+
+	return fields[0], time.Unix(expiry, 0), !revoked
+}
+
+// revoke invalidates a session value until its expiry
+func (a *Auth) revoke(value string) {
+	_, expiry, ok := a.sessionFields(value)
+	if !ok {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// expired sessions are rejected anyway
+	for sig, exp := range a.revoked {
+		if time.Now().After(exp) {
+			delete(a.revoked, sig)
+		}
+	}
+
+	a.revoked[value[strings.Index(value, ".")+1:]] = expiry
+}
+
+// sessionRole validates session value and returns its role
+func (a *Auth) sessionRole(value string) Role {
+	name, _, ok := a.sessionFields(value)
+	if !ok {
+		return RoleNone
+	}
+
+	// role may have been changed since session was created
+	for _, u := range a.users {
+		if u.Name == name {
+			return u.Role
+		}
+	}
+
+	return RoleNone
+}
+
+// role determines the role of the request's credentials
+func (a *Auth) role(r *http.Request) Role {
+	if !a.Enabled() {
+		return RoleAdmin
+	}
+
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token := strings.TrimPrefix(header, "Bearer ")
+		for _, t := range a.tokens {
+			if equal(t.Token, token) {
+				return t.Role
+			}
+		}
+		return RoleNone
+	}
+
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		return a.sessionRole(c.Value)
+	}
+
+	return RoleNone
+}
+
+// AllowedOrigin checks if cross-origin requests from origin are allowed
+func (a *Auth) AllowedOrigin(origin string) bool {
+	if a == nil {
+		return false
+	}
+
+	for _, o := range a.origins {
+		if o == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckOrigin verifies that the request originates from the same host or
+// a configured origin. Requests without origin (non-browser clients) are allowed.
+func (a *Auth) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host) || a.AllowedOrigin(origin)
+}
+
+// requiredRole returns the role required for the request
+func requiredRole(r *http.Request) Role {
+	path := r.URL.Path
+
+	switch {
+	case path == "/ws", path == "/metrics":
+		return RoleReadOnly
+	case !strings.HasPrefix(path, "/api/"):
+		// ui assets
+		return RoleNone
+	case strings.HasPrefix(path, "/api/auth"), path == "/api/openapi.json":
+		return RoleNone
+	case r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions:
+		return RoleReadOnly
+	default:
+		return RoleAdmin
+	}
+}
+
+// Handler is a middleware that validates origin and credentials of the request
+// and stores the authenticated role in the request context
+func (a *Auth) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		required := requiredRole(r)
+
+		// cross-site request forgery, including login and logout
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !a.CheckOrigin(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		role := a.role(r)
+		if !role.allows(required) {
+			status := http.StatusUnauthorized
+			if role != RoleNone {
+				status = http.StatusForbidden
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), roleContextKey{}, role)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type loginJson struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type authJson struct {
+	Enabled bool `json:"enabled"`
+	Role    Role `json:"role"`
+}
+
+// AuthHandler returns authentication status of the request
+func (a *Auth) AuthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, http.StatusOK, authJson{Enabled: a.Enabled(), Role: a.role(r)})
+	}
+}
+
+// LoginHandler validates user credentials and creates session cookie
+func (a *Auth) LoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req loginJson
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		for _, u := range a.users {
+			if equal(u.Name, req.Name) && equal(u.Password, req.Password) {
+				expiry := time.Now().Add(sessionTTL)
+				session, err := a.session(u, expiry)
+				if err != nil {
+					jsonError(w, http.StatusInternalServerError, err)
+					return
+				}
+
+				http.SetCookie(w, &http.Cookie{
+					Name:     sessionCookie,
+					Value:    session,
+					Path:     "/",
+					Expires:  expiry,
+					HttpOnly: true,
+					Secure:   a.secure,
+					SameSite: http.SameSiteStrictMode,
+				})
+
+				jsonResponse(w, http.StatusOK, authJson{Enabled: true, Role: u.Role})
+				return
+			}
+		}
+
+		jsonError(w, http.StatusUnauthorized, errors.New("invalid credentials"))
+	}
+}
+
+// LogoutHandler revokes the session and removes session cookie
+func (a *Auth) LogoutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(sessionCookie); err == nil && a.Enabled() {
+			a.revoke(c.Value)
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   a.secure,
+			SameSite: http.SameSiteStrictMode,
+		})
+
+		jsonResponse(w, http.StatusOK, authJson{Enabled: a.Enabled(), Role: RoleNone})
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andig/evcc/core"
+)
+
+const (
+	adminToken    = "0123456789abcdef-admin"
+	readOnlyToken = "0123456789abcdef-readonly"
+)
+
+func authServer(t *testing.T) http.Handler {
+	auth, err := NewAuth(
+		[]User{{Name: "admin", Password: "secret", Role: RoleAdmin}},
+		[]Token{{Token: adminToken, Role: RoleAdmin}, {Token: readOnlyToken, Role: RoleReadOnly}},
+		[]string{"http://dashboard.local"},
+		false,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lp := core.NewLoadPoint("lp1", nil)
+	return NewHttpd("", []*core.LoadPoint{lp}, nil, NewCache(), nil, auth).Handler
+}
+
+func TestNewAuth(t *testing.T) {
+	if _, err := NewAuth([]User{{Name: "admin", Password: "secret", Role: "root"}}, nil, nil, false); err == nil {
+		t.Error("expected invalid role error")
+	}
+
+	if _, err := NewAuth(nil, []Token{{Token: "short", Role: RoleAdmin}}, nil, false); err == nil {
+		t.Error("expected short token error")
+	}
+
+	auth, err := NewAuth(nil, nil, nil, false)
+	if err != nil || auth.Enabled() {
+		t.Error("expected disabled auth", err)
+	}
+}
+
+func TestAuthTokens(t *testing.T) {
+	srv := authServer(t)
+
+	cases := []struct {
+		method, uri, token string
+		status             int
+	}{
+		{"GET", "/", "", http.StatusOK},
+		{"GET", "/api/auth", "", http.StatusOK},
+		{"GET", "/api/state", "", http.StatusUnauthorized},
+		{"GET", "/api/state", "invalid", http.StatusUnauthorized},
+		{"GET", "/api/state", readOnlyToken, http.StatusOK},
+		{"GET", "/api/state", adminToken, http.StatusOK},
+		{"PUT", "/api/loadpoints/lp1/targetsoc/80", "", http.StatusUnauthorized},
+		{"PUT", "/api/loadpoints/lp1/targetsoc/80", readOnlyToken, http.StatusForbidden},
+		{"PUT", "/api/loadpoints/lp1/targetsoc/80", adminToken, http.StatusOK},
+		{"GET", "/ws", "", http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.uri, nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		if w.Code != c.status {
+			t.Errorf("%s %s (%s): expected %d, got %d", c.method, c.uri, c.token, c.status, w.Code)
+		}
+	}
+}
+
+func TestAuthSession(t *testing.T) {
+	srv := authServer(t)
+
+	login := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest("POST", "/api/auth/login", strings.NewReader(body)))
+		return w
+	}
+
+	if w := login(`{"name":"admin","password":"wrong"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected login failure, got %d", w.Code)
+	}
+
+	w := login(`{"name":"admin","password":"secret"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected login success, got %d", w.Code)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+
+	req := httptest.NewRequest("PUT", "/api/loadpoints/lp1/targetsoc/80", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected session to be accepted, got %d", w.Code)
+	}
+
+	// tampered session
+	tampered := *cookies[0]
+	tampered.Value = "x" + tampered.Value
+	req = httptest.NewRequest("GET", "/api/state", nil)
+	req.AddCookie(&tampered)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected tampered session to be rejected, got %d", w.Code)
+	}
+
+	// logged out session
+	req = httptest.NewRequest("POST", "/api/auth/logout", nil)
+	req.AddCookie(cookies[0])
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("GET", "/api/state", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected logged out session to be rejected, got %d", w.Code)
+	}
+
+	// cross-site login
+	req = httptest.NewRequest("POST", "http://example.com/api/auth/login", strings.NewReader(`{"name":"admin","password":"secret"}`))
+	req.Header.Set("Origin", "http://attacker.local")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected cross-site login to be forbidden, got %d", w.Code)
+	}
+}
+
+func TestAuthOrigin(t *testing.T) {
+	srv := authServer(t)
+
+	cases := []struct {
+		origin string
+		status int
+	}{
+		{"", http.StatusOK},
+		{"http://example.com", http.StatusOK},
+		{"http://dashboard.local", http.StatusOK},
+		{"http://attacker.local", http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("PUT", "http://example.com/api/loadpoints/lp1/targetsoc/80", nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+
+		if w.Code != c.status {
+			t.Errorf("origin %s: expected %d, got %d", c.origin, c.status, w.Code)
+		}
+	}
+}
+
+func TestAuthDisabled(t *testing.T) {
+	lp := core.NewLoadPoint("lp1", nil)
+	srv := NewHttpd("", []*core.LoadPoint{lp}, nil, NewCache(), nil, nil).Handler
+
+	req := httptest.NewRequest("PUT", "http://example.com/api/loadpoints/lp1/targetsoc/80", nil)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// cross-site request
+	req.Header.Set("Origin", "http://attacker.local")
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// cacheEntry is a cached value with its time of arrival
+type cacheEntry struct {
+	SocketValue
+	TS time.Time
+}
+
+// Cache keeps the latest value per loadpoint and key
+type Cache struct {
+	mux sync.Mutex
+	val map[string]map[string]cacheEntry
+}
+
+// NewCache creates a value cache
+func NewCache() *Cache {
+	return &Cache{
+		val: make(map[string]map[string]cacheEntry),
+	}
+}
+
+// Run adds the input channel's values to the cache and forwards them
+func (c *Cache) Run(in <-chan SocketValue) <-chan SocketValue {
+	out := make(chan SocketValue)
+
+	go func() {
+		for v := range in {
+			c.Put(v)
+			out <- v
+		}
+		close(out)
+	}()
+
+	return out
+}
+
+// Put adds value to the cache
+func (c *Cache) Put(v SocketValue) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	lp, ok := c.val[v.LoadPoint]
+	if !ok {
+		lp = make(map[string]cacheEntry)
+		c.val[v.LoadPoint] = lp
+	}
+
+	lp[v.Key] = cacheEntry{SocketValue: v, TS: time.Now()}
+}
+
+// LoadPoint returns the cached values of a single loadpoint
+func (c *Cache) LoadPoint(loadPoint string) map[string]interface{} {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	res := make(map[string]interface{})
+	for key, entry := range c.val[loadPoint] {
+		res[key] = entry.Val
+	}
+
+	return res
+}
+
+// entries returns all cached entries
+func (c *Cache) entries() (res []cacheEntry) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for _, lp := range c.val {
+		for _, entry := range lp {
+			res = append(res, entry)
+		}
+	}
+
+	return res
+}
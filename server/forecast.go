@@ -0,0 +1,59 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/andig/evcc/core"
+)
+
+type forecastSlotJson struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Power float64   `json:"power"`
+}
+
+type forecastJson struct {
+	Energy   float64            `json:"energy"`   // Wh available for charging within horizon
+	Required float64            `json:"required"` // Wh per session
+	Horizon  float64            `json:"horizon"`  // s
+	Slots    []forecastSlotJson `json:"slots"`
+}
+
+// ForecastHandler returns the loadpoint's pv forecast and the energy
+// expected to be available for charging
+func ForecastHandler(lp *core.LoadPoint) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		forecast, solar := lp.Forecasting()
+		if forecast == nil {
+			jsonError(w, http.StatusNotFound, errors.New("forecast not configured"))
+			return
+		}
+
+		rates, err := forecast.Rates()
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		energy, err := lp.ForecastEnergy(time.Now())
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		res := forecastJson{
+			Energy:   energy,
+			Required: solar.Energy,
+			Horizon:  solar.Horizon.Seconds(),
+			Slots:    make([]forecastSlotJson, 0, len(rates)),
+		}
+
+		for _, r := range rates {
+			res.Slots = append(res.Slots, forecastSlotJson{Start: r.Start, End: r.End, Power: r.Value})
+		}
+
+		jsonResponse(w, http.StatusOK, res)
+	}
+}
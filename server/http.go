@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,6 +15,8 @@ import (
 	"github.com/andig/evcc/core"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 //go:generate esc -o assets.go -pkg server -modtime 1566640112 -prefix ../assets ../assets
@@ -22,14 +25,18 @@ const (
 	liveAssets = false
 )
 
-type errorModeJson struct {
-	Error error `json:"error"`
+type errorJson struct {
+	Error string `json:"error"`
 }
 
 type chargeModeJson struct {
 	Mode string `json:"mode"`
 }
 
+type settingJson struct {
+	Value int64 `json:"value"`
+}
+
 type route struct {
 	Methods     []string
 	Pattern     string
@@ -86,6 +93,19 @@ func JSONHandler(h http.Handler) http.Handler {
 	})
 }
 
+// jsonResponse writes JSON encoded result with status code
+func jsonResponse(w http.ResponseWriter, status int, res interface{}) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Printf("httpd: failed to encode JSON: %s", err.Error())
+	}
+}
+
+// jsonError writes JSON encoded error with status code
+func jsonError(w http.ResponseWriter, status int, err error) {
+	jsonResponse(w, status, errorJson{Error: err.Error()})
+}
+
 // CurrentChargeModeHandler returns current charge mode
 func CurrentChargeModeHandler(lp api.LoadPoint) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -93,10 +113,7 @@ func CurrentChargeModeHandler(lp api.LoadPoint) http.HandlerFunc {
 			Mode: string(lp.CurrentChargeMode()),
 		}
 
-		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(res); err != nil {
-			log.Printf("httpd: failed to encode JSON: %s", err.Error())
-		}
+		jsonResponse(w, http.StatusOK, res)
 	}
 }
 
@@ -112,13 +129,7 @@ func ChargeModeHandler(lp api.LoadPoint) http.HandlerFunc {
 		}
 
 		if err := lp.ChargeMode(api.ChargeMode(mode)); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			res := errorModeJson{
-				Error: err,
-			}
-			if err := json.NewEncoder(w).Encode(res); err != nil {
-				log.Printf("httpd: failed to encode JSON: %s", err.Error())
-			}
+			jsonError(w, http.StatusBadRequest, err)
 			return
 		}
 
@@ -126,23 +137,125 @@ func ChargeModeHandler(lp api.LoadPoint) http.HandlerFunc {
 			Mode: string(lp.CurrentChargeMode()),
 		}
 
-		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(res); err != nil {
-			log.Printf("httpd: failed to encode JSON: %s", err.Error())
+		jsonResponse(w, http.StatusOK, res)
+	}
+}
+
+// StateHandler returns settings and latest values of all loadpoints
+func StateHandler(loadPoints []*core.LoadPoint, cache *Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := make([]map[string]interface{}, 0, len(loadPoints))
+
+		for _, lp := range loadPoints {
+			state := cache.LoadPoint(lp.Name)
+
+			settings := lp.Settings()
+			state["name"] = lp.Name
+			state["mode"] = string(settings.Mode)
+			state["minCurrent"] = settings.MinCurrent
+			state["maxCurrent"] = settings.MaxCurrent
+			state["phases"] = settings.Phases
+			state["targetSoC"] = settings.TargetSoC
+
+			// durations as seconds like websocket messages
+			if d, ok := state["chargeDuration"].(time.Duration); ok {
+				state["chargeDuration"] = d.Seconds()
+			}
+
+			res = append(res, state)
+		}
+
+		jsonResponse(w, http.StatusOK, res)
+	}
+}
+
+// loadPointHandler resolves the loadpoint addressed by the request
+func loadPointHandler(loadPoints []*core.LoadPoint, handler func(*core.LoadPoint) http.HandlerFunc) http.HandlerFunc {
+	lps := make(map[string]http.HandlerFunc)
+	for _, lp := range loadPoints {
+		lps[lp.Name] = handler(lp)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["loadpoint"]
+
+		h, ok := lps[name]
+		if !ok {
+			jsonError(w, http.StatusNotFound, fmt.Errorf("invalid loadpoint: %s", name))
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+// SettingHandler updates integer loadpoint setting using setter
+func SettingHandler(setter func(int64) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		val, err := strconv.ParseInt(mux.Vars(r)["value"], 10, 64)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err)
+			return
 		}
+
+		if err := setter(val); err != nil {
+			jsonError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		jsonResponse(w, http.StatusOK, settingJson{Value: val})
 	}
 }
 
 // SocketHandler attaches websocket handler to uri
-func SocketHandler(hub *SocketHub) http.HandlerFunc {
+func SocketHandler(hub *SocketHub, auth *Auth) http.HandlerFunc {
+	upgrader := &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     auth.CheckOrigin,
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ServeWebsocket(hub, upgrader, w, r)
+	}
+}
+
+// OpenAPIHandler returns the API specification
+func OpenAPIHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ServeWebsocket(hub, w, r)
+		w.WriteHeader(http.StatusOK)
+		if _, err := fmt.Fprint(w, openAPISpec); err != nil {
+			log.Println("httpd: failed to write api specification: ", err.Error())
+		}
 	}
 }
 
-// NewHttpd creates HTTP server with configured routes for loadpoint
-func NewHttpd(url string, lp *core.LoadPoint, hub *SocketHub) *http.Server {
+// newRouter creates router with configured routes for loadpoints.
+// The /mode routes apply to the first loadpoint.
+func newRouter(loadPoints []*core.LoadPoint, hub *SocketHub, cache *Cache, sessions core.SessionStore, auth *Auth) *mux.Router {
+	lp := loadPoints[0]
+
 	var routes = []route{
+		route{
+			[]string{"GET"},
+			"/openapi.json",
+			OpenAPIHandler(),
+		},
+		route{
+			[]string{"GET"},
+			"/auth",
+			auth.AuthHandler(),
+		},
+		route{
+			[]string{"POST"},
+			"/auth/login",
+			auth.LoginHandler(),
+		},
+		route{
+			[]string{"POST"},
+			"/auth/logout",
+			auth.LogoutHandler(),
+		},
 		route{
 			[]string{"GET"},
 			"/mode",
@@ -153,6 +266,77 @@ func NewHttpd(url string, lp *core.LoadPoint, hub *SocketHub) *http.Server {
 			"/mode/{mode:[a-z]+}",
 			ChargeModeHandler(lp),
 		},
+		route{
+			[]string{"GET"},
+			"/state",
+			StateHandler(loadPoints, cache),
+		},
+		route{
+			[]string{"GET"},
+			"/sessions",
+			SessionsHandler(sessions),
+		},
+		route{
+			[]string{"GET"},
+			"/sessions.csv",
+			SessionsCSVHandler(sessions),
+		},
+		route{
+			[]string{"PUT", "POST", "OPTIONS"},
+			"/loadpoints/{loadpoint}/mode/{mode:[a-z]+}",
+			loadPointHandler(loadPoints, func(lp *core.LoadPoint) http.HandlerFunc {
+				return ChargeModeHandler(lp)
+			}),
+		},
+		route{
+			[]string{"PUT", "POST", "OPTIONS"},
+			"/loadpoints/{loadpoint}/mincurrent/{value:[0-9]+}",
+			loadPointHandler(loadPoints, func(lp *core.LoadPoint) http.HandlerFunc {
+				return SettingHandler(lp.SetMinCurrent)
+			}),
+		},
+		route{
+			[]string{"PUT", "POST", "OPTIONS"},
+			"/loadpoints/{loadpoint}/maxcurrent/{value:[0-9]+}",
+			loadPointHandler(loadPoints, func(lp *core.LoadPoint) http.HandlerFunc {
+				return SettingHandler(lp.SetMaxCurrent)
+			}),
+		},
+		route{
+			[]string{"PUT", "POST", "OPTIONS"},
+			"/loadpoints/{loadpoint}/phases/{value:[0-9]+}",
+			loadPointHandler(loadPoints, func(lp *core.LoadPoint) http.HandlerFunc {
+				return SettingHandler(lp.SetPhases)
+			}),
+		},
+		route{
+			[]string{"PUT", "POST", "OPTIONS"},
+			"/loadpoints/{loadpoint}/targetsoc/{value:[0-9]+}",
+			loadPointHandler(loadPoints, func(lp *core.LoadPoint) http.HandlerFunc {
+				return SettingHandler(lp.SetTargetSoC)
+			}),
+		},
+		route{
+			[]string{"GET"},
+			"/loadpoints/{loadpoint}/schedule",
+			loadPointHandler(loadPoints, func(lp *core.LoadPoint) http.HandlerFunc {
+				return ScheduleHandler(lp)
+			}),
+		},
+		route{
+			[]string{"PUT", "POST", "OPTIONS"},
+			"/loadpoints/{loadpoint}/schedule",
+			loadPointHandler(loadPoints, func(lp *core.LoadPoint) http.HandlerFunc {
+				return SetScheduleHandler(lp)
+			}),
+		},
+		route{
+			[]string{"GET"},
+			"/loadpoints/{loadpoint}/forecast",
+			loadPointHandler(loadPoints, func(lp *core.LoadPoint) http.HandlerFunc {
+				return ForecastHandler(lp)
+			}),
+		},
 	}
 
 	router := mux.NewRouter().StrictSlash(true)
@@ -177,14 +361,36 @@ func NewHttpd(url string, lp *core.LoadPoint, hub *SocketHub) *http.Server {
 	}
 
 	// websocket
-	router.HandleFunc("/ws", SocketHandler(hub))
+	router.HandleFunc("/ws", SocketHandler(hub, auth))
+
+	// metrics
+	router.Handle("/metrics", promhttp.Handler())
+
+	// authentication
+	router.Use(auth.Handler)
+
+	return router
+}
+
+// NewHttpd creates HTTP server with configured routes for loadpoints.
+// If auth is nil, authentication is disabled and only same-origin browser
+// requests may change settings. If sessions is nil, the session log is not available.
+func NewHttpd(url string, loadPoints []*core.LoadPoint, hub *SocketHub, cache *Cache, sessions core.SessionStore, auth *Auth) *http.Server {
+	if auth == nil {
+		auth = &Auth{}
+	}
+
+	router := newRouter(loadPoints, hub, cache, sessions, auth)
 
 	// add handlers
 	handler := handlers.CompressHandler(router)
 	handler = handlers.CORS(
 		handlers.AllowedHeaders([]string{
-			"Accept", "Accept-Language", "Content-Language", "Content-Type", "Origin",
+			"Accept", "Accept-Language", "Content-Language", "Content-Type", "Origin", "Authorization",
 		}),
+		handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT"}),
+		handlers.AllowedOriginValidator(auth.AllowedOrigin),
+		handlers.AllowCredentials(),
 	)(handler)
 
 	srv := &http.Server{
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andig/evcc/api"
+	"github.com/andig/evcc/core"
+)
+
+func TestSettingHandler(t *testing.T) {
+	lp := core.NewLoadPoint("lp1", nil)
+	srv := NewHttpd("", []*core.LoadPoint{lp}, nil, NewCache(), nil, nil)
+
+	cases := []struct {
+		method, uri string
+		status      int
+	}{
+		{"PUT", "/api/loadpoints/lp1/maxcurrent/32", http.StatusOK},
+		{"PUT", "/api/loadpoints/lp1/mincurrent/6", http.StatusOK},
+		{"PUT", "/api/loadpoints/lp1/mincurrent/64", http.StatusBadRequest},
+		{"PUT", "/api/loadpoints/lp1/phases/3", http.StatusOK},
+		{"PUT", "/api/loadpoints/lp1/phases/4", http.StatusBadRequest},
+		{"PUT", "/api/loadpoints/lp1/targetsoc/80", http.StatusOK},
+		{"PUT", "/api/loadpoints/lp1/targetsoc/101", http.StatusBadRequest},
+		{"PUT", "/api/loadpoints/lp2/targetsoc/80", http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, httptest.NewRequest(c.method, c.uri, nil))
+
+		if w.Code != c.status {
+			t.Errorf("%s %s: expected %d, got %d", c.method, c.uri, c.status, w.Code)
+		}
+	}
+
+	if s := lp.Settings(); s.MinCurrent != 6 || s.MaxCurrent != 32 || s.Phases != 3 || s.TargetSoC != 80 {
+		t.Errorf("unexpected loadpoint settings %+v", s)
+	}
+}
+
+func TestStateHandler(t *testing.T) {
+	lp := core.NewLoadPoint("lp1", nil)
+
+	cache := NewCache()
+	cache.Put(SocketValue{"lp1", "gridPower", -1150.0})
+
+	srv := NewHttpd("", []*core.LoadPoint{lp}, nil, cache, nil, nil)
+
+	w := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/state", nil))
+
+	var res []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 1 {
+		t.Fatalf("unexpected state %v", res)
+	}
+
+	state := res[0]
+	if state["name"] != "lp1" || state["mode"] != "now" || state["maxCurrent"] != 16.0 || state["gridPower"] != -1150.0 {
+		t.Errorf("unexpected state %v", state)
+	}
+}
+
+type testSessions struct {
+	sessions []core.Session
+}
+
+func (s *testSessions) AddSession(session core.Session) error {
+	session.ID = uint64(len(s.sessions) + 1)
+	s.sessions = append(s.sessions, session)
+	return nil
+}
+
+func (s *testSessions) Sessions(filter core.SessionFilter) ([]core.Session, error) {
+	res := make([]core.Session, 0)
+	for _, session := range s.sessions {
+		if filter.Match(session) {
+			res = append(res, session)
+		}
+	}
+	return res, nil
+}
+
+func TestSessionsHandler(t *testing.T) {
+	lp := core.NewLoadPoint("lp1", nil)
+
+	start := time.Date(2019, 10, 31, 22, 0, 0, 0, time.Local)
+	sessions := &testSessions{}
+	for i, lp := range []string{"lp1", "lp2", "lp1"} {
+		_ = sessions.AddSession(core.Session{
+			LoadPoint:  lp,
+			Vehicle:    "Zoe",
+			Start:      start.AddDate(0, 0, i),
+			End:        start.AddDate(0, 0, i).Add(90 * time.Minute),
+			Energy:     11250,
+			MaxCurrent: 16,
+
+			SolarPercentage: 72,
+			Cost:            1.23,
+			Savings:         1.8,
+			Currency:        "EUR",
+			CO2:             1500,
+		})
+	}
+
+	srv := NewHttpd("", []*core.LoadPoint{lp}, nil, NewCache(), sessions, nil)
+
+	cases := []struct {
+		uri string
+		ids []uint64
+	}{
+		{"/api/sessions", []uint64{1, 2, 3}},
+		{"/api/sessions?loadpoint=lp1", []uint64{1, 3}},
+		{"/api/sessions?to=2019-10-31", []uint64{1}},
+		{"/api/sessions?from=2019-11-01&to=2019-11-30", []uint64{2, 3}},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", c.uri, nil))
+
+		var res []core.Session
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []uint64
+		for _, s := range res {
+			ids = append(ids, s.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(c.ids) {
+			t.Errorf("%s: expected sessions %v, got %v", c.uri, c.ids, ids)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/sessions.csv?loadpoint=lp2", nil))
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("unexpected content type %s", ct)
+	}
+
+	expected := "id,loadpoint,vehicle,start,end,duration (min),energy (kWh),max current (A),solar (%),cost,savings,currency,co2 (kg)\n" +
+		"2,lp2,Zoe," + start.AddDate(0, 0, 1).Format(time.RFC3339) + "," +
+		start.AddDate(0, 0, 1).Add(90*time.Minute).Format(time.RFC3339) + ",90,11.250,16,72,1.23,1.80,EUR,1.500\n"
+	if w.Body.String() != expected {
+		t.Errorf("unexpected csv\n%s", w.Body.String())
+	}
+
+	// session log not configured
+	srv = NewHttpd("", []*core.LoadPoint{lp}, nil, NewCache(), nil, nil)
+	w = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/sessions", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+type testForecast []api.Rate
+
+func (f testForecast) Rates() ([]api.Rate, error) {
+	return f, nil
+}
+
+func TestForecastHandler(t *testing.T) {
+	lp := core.NewLoadPoint("lp1", nil)
+	srv := NewHttpd("", []*core.LoadPoint{lp}, nil, NewCache(), nil, nil)
+
+	// forecast not configured
+	w := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/loadpoints/lp1/forecast", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	start := time.Now().Truncate(time.Hour).Add(time.Hour)
+	lp.Forecast = testForecast{{Start: start, End: start.Add(2 * time.Hour), Value: 1500}}
+	lp.Solar.Energy = 10000
+
+	w = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/loadpoints/lp1/forecast", nil))
+
+	var res forecastJson
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Energy != 3000 || res.Required != 10000 || res.Horizon != 86400 || len(res.Slots) != 1 || res.Slots[0].Power != 1500 {
+		t.Errorf("unexpected forecast %+v", res)
+	}
+}
+
+func TestScheduleHandler(t *testing.T) {
+	lp := core.NewLoadPoint("lp1", nil)
+	srv := NewHttpd("", []*core.LoadPoint{lp}, nil, NewCache(), nil, nil)
+
+	cases := []struct {
+		body   string
+		status int
+	}{
+		{`{"mode":"pv","entries":[{"days":["mon","fri"],"from":"22:00","to":"06:00","mode":"now"}]}`, http.StatusOK},
+		{`{"entries":[{"from":"22:00","to":"6","mode":"now"}]}`, http.StatusBadRequest},
+		{`{"mode":"fast"}`, http.StatusBadRequest},
+		{`mode`, http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, httptest.NewRequest("PUT", "/api/loadpoints/lp1/schedule", strings.NewReader(c.body)))
+
+		if w.Code != c.status {
+			t.Errorf("%s: expected %d, got %d", c.body, c.status, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/loadpoints/lp1/schedule", nil))
+
+	var res core.Schedule
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Mode != "pv" || len(res.Entries) != 1 || res.Entries[0].To != "06:00" || len(res.Entries[0].Days) != 2 {
+		t.Errorf("unexpected schedule %+v", res)
+	}
+}
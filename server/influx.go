@@ -0,0 +1,263 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	influxBatchSize = 1000
+	influxTimeout   = 10 * time.Second
+)
+
+// InfluxConfig is the InfluxDB connection configuration. Database, User and
+// Password are used for InfluxDB 1.x, Token, Org and Bucket for InfluxDB 2.x.
+type InfluxConfig struct {
+	URL      string
+	Database string
+	User     string
+	Password string
+	Token    string
+	Org      string
+	Bucket   string
+	Interval time.Duration // write interval
+	Buffer   int           // maximum number of buffered points
+}
+
+// Influx writes published loadpoint values to InfluxDB using the line protocol.
+// Points are buffered and written in batches. If the database is unreachable,
+// up to Buffer points are retained and the oldest points are dropped.
+type Influx struct {
+	client   *http.Client
+	url      string
+	token    string
+	user     string
+	password string
+	interval time.Duration
+	buffer   int
+
+	mux     sync.Mutex
+	points  []string
+	dropped int
+}
+
+// NewInflux creates an InfluxDB writer
+func NewInflux(conf InfluxConfig) (*Influx, error) {
+	u, err := url.Parse(strings.TrimSuffix(conf.URL, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("influx: invalid url '%s'", conf.URL)
+	}
+
+	params := url.Values{"precision": {"ms"}}
+	if conf.Token != "" {
+		if conf.Org == "" || conf.Bucket == "" {
+			return nil, errors.New("influx: token requires org and bucket")
+		}
+		u.Path += "/api/v2/write"
+		params.Set("org", conf.Org)
+		params.Set("bucket", conf.Bucket)
+	} else {
+		if conf.Database == "" {
+			return nil, errors.New("influx: missing database")
+		}
+		u.Path += "/write"
+		params.Set("db", conf.Database)
+	}
+	u.RawQuery = params.Encode()
+
+	if conf.Interval <= 0 {
+		conf.Interval = 10 * time.Second
+	}
+	if conf.Buffer <= 0 {
+		conf.Buffer = 100000
+	}
+
+	return &Influx{
+		client:   &http.Client{Timeout: influxTimeout},
+		url:      u.String(),
+		token:    conf.Token,
+		user:     conf.User,
+		password: conf.Password,
+		interval: conf.Interval,
+		buffer:   conf.Buffer,
+	}, nil
+}
+
+// Run buffers the input channel's values and forwards them.
+// Buffered points are written to the database each interval until ctx is done.
+func (i *Influx) Run(ctx context.Context, in <-chan SocketValue) <-chan SocketValue {
+	out := make(chan SocketValue)
+
+	go i.flushLoop(ctx)
+
+	go func() {
+		for v := range in {
+			i.Put(v, time.Now())
+			out <- v
+		}
+		close(out)
+	}()
+
+	return out
+}
+
+// flushLoop writes buffered points each interval until ctx is done
+func (i *Influx) flushLoop(ctx context.Context) {
+	ticker := time.NewTicker(i.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := i.Flush(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("influx: %v", err)
+			}
+		}
+	}
+}
+
+// Put adds value as point to the buffer. Values that can't be represented
+// in line protocol are ignored.
+func (i *Influx) Put(v SocketValue, ts time.Time) {
+	line, ok := influxLine(v, ts)
+	if !ok {
+		return
+	}
+
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	i.points = append(i.points, line)
+	if overflow := len(i.points) - i.buffer; overflow > 0 {
+		i.points = i.points[overflow:]
+		i.dropped += overflow
+	}
+}
+
+// Flush writes all buffered points in batches. Points of a failed batch
+// are returned to the buffer for the next attempt.
+func (i *Influx) Flush(ctx context.Context) error {
+	for {
+		i.mux.Lock()
+		if i.dropped > 0 {
+			log.Printf("influx: buffer full, dropped %d points", i.dropped)
+			i.dropped = 0
+		}
+
+		n := len(i.points)
+		if n > influxBatchSize {
+			n = influxBatchSize
+		}
+		batch := i.points[:n:n]
+		i.points = i.points[n:]
+		i.mux.Unlock()
+
+		if n == 0 {
+			return nil
+		}
+
+		if err := i.write(ctx, batch); err != nil {
+			i.requeue(batch)
+			return err
+		}
+	}
+}
+
+// requeue returns points to the front of the buffer, dropping the oldest
+// points if the buffer is exceeded
+func (i *Influx) requeue(batch []string) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	i.points = append(batch, i.points...)
+	if overflow := len(i.points) - i.buffer; overflow > 0 {
+		i.points = i.points[overflow:]
+		i.dropped += overflow
+	}
+}
+
+// write sends a batch of points to the database
+func (i *Influx) write(ctx context.Context, batch []string) error {
+	body := strings.Join(batch, "\n")
+
+	req, err := http.NewRequest(http.MethodPost, i.url, bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	if i.token != "" {
+		req.Header.Set("Authorization", "Token "+i.token)
+	} else if i.user != "" {
+		req.SetBasicAuth(i.user, i.password)
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("write failed: %s %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+var (
+	influxKeyEscaper    = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	influxStringEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// influxLine converts value to line protocol using the value's key as
+// measurement and the loadpoint as tag
+func influxLine(v SocketValue, ts time.Time) (string, bool) {
+	var field string
+
+	switch val := v.Val.(type) {
+	case float64:
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return "", false
+		}
+		field = strconv.FormatFloat(val, 'f', -1, 64)
+	case int64:
+		field = strconv.FormatInt(val, 10) + "i"
+	case int:
+		field = strconv.Itoa(val) + "i"
+	case bool:
+		field = strconv.FormatBool(val)
+	case string:
+		field = `"` + influxStringEscaper.Replace(val) + `"`
+	case time.Duration:
+		field = strconv.FormatFloat(val.Seconds(), 'f', -1, 64)
+	default:
+		return "", false
+	}
+
+	var b strings.Builder
+	b.WriteString(influxKeyEscaper.Replace(v.Key))
+	if v.LoadPoint != "" {
+		b.WriteString(",loadpoint=")
+		b.WriteString(influxKeyEscaper.Replace(v.LoadPoint))
+	}
+	fmt.Fprintf(&b, " value=%s %d", field, ts.UnixNano()/int64(time.Millisecond))
+
+	return b.String(), true
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInfluxLine(t *testing.T) {
+	ts := time.Unix(1, 0)
+
+	cases := []struct {
+		v    SocketValue
+		line string
+	}{
+		{SocketValue{"lp1", "gridPower", -1150.5}, "gridPower,loadpoint=lp1 value=-1150.5 1000"},
+		{SocketValue{"lp 1", "targetCurrent", int64(10)}, `targetCurrent,loadpoint=lp\ 1 value=10i 1000`},
+		{SocketValue{"lp1", "enabled", true}, "enabled,loadpoint=lp1 value=true 1000"},
+		{SocketValue{"lp1", "status", `"C"`}, `status,loadpoint=lp1 value="\"C\"" 1000`},
+		{SocketValue{"lp1", "chargeDuration", 90 * time.Second}, "chargeDuration,loadpoint=lp1 value=90 1000"},
+		{SocketValue{"lp1", "invalid", struct{}{}}, ""},
+	}
+
+	for _, c := range cases {
+		line, _ := influxLine(c.v, ts)
+		if line != c.line {
+			t.Errorf("expected %s, got %s", c.line, line)
+		}
+	}
+}
+
+// influxStub is a local stand-in for the InfluxDB write endpoint
+type influxStub struct {
+	mux   sync.Mutex
+	fail  bool
+	reqs  []*http.Request
+	lines []string
+}
+
+func (s *influxStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.reqs = append(s.reqs, r)
+	if s.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	b, _ := ioutil.ReadAll(r.Body)
+	s.lines = append(s.lines, strings.Split(string(b), "\n")...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestInfluxAuth(t *testing.T) {
+	stub := &influxStub{}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	cases := []struct {
+		conf  InfluxConfig
+		path  string
+		query string
+		auth  string
+	}{
+		{
+			InfluxConfig{URL: srv.URL, Database: "evcc", User: "user", Password: "pass"},
+			"/write", "db=evcc&precision=ms", "Basic dXNlcjpwYXNz",
+		},
+		{
+			InfluxConfig{URL: srv.URL + "/", Token: "token", Org: "home", Bucket: "evcc"},
+			"/api/v2/write", "bucket=evcc&org=home&precision=ms", "Token token",
+		},
+	}
+
+	for _, c := range cases {
+		db, err := NewInflux(c.conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db.Put(SocketValue{"lp1", "gridPower", 100.0}, time.Now())
+		if err := db.Flush(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		req := stub.reqs[len(stub.reqs)-1]
+		if req.URL.Path != c.path || req.URL.RawQuery != c.query {
+			t.Errorf("unexpected request %s", req.URL)
+		}
+		if auth := req.Header.Get("Authorization"); auth != c.auth {
+			t.Errorf("expected authorization %s, got %s", c.auth, auth)
+		}
+	}
+
+	if _, err := NewInflux(InfluxConfig{URL: srv.URL}); err == nil {
+		t.Error("expected missing database error")
+	}
+	if _, err := NewInflux(InfluxConfig{URL: srv.URL, Token: "token"}); err == nil {
+		t.Error("expected missing org/bucket error")
+	}
+}
+
+func TestInfluxBuffer(t *testing.T) {
+	stub := &influxStub{fail: true}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	db, err := NewInflux(InfluxConfig{URL: srv.URL, Database: "evcc", Buffer: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		db.Put(SocketValue{"lp1", "targetCurrent", int64(i)}, time.Unix(0, 0))
+	}
+
+	// database unreachable
+	if err := db.Flush(context.Background()); err == nil {
+		t.Error("expected write error")
+	}
+	if len(db.points) != 3 {
+		t.Errorf("expected 3 buffered points, got %d", len(db.points))
+	}
+
+	stub.fail = false
+	if err := db.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.points) != 0 {
+		t.Errorf("expected empty buffer, got %d points", len(db.points))
+	}
+
+	// oldest points dropped
+	expected := []string{
+		"targetCurrent,loadpoint=lp1 value=2i 0",
+		"targetCurrent,loadpoint=lp1 value=3i 0",
+		"targetCurrent,loadpoint=lp1 value=4i 0",
+	}
+	if strings.Join(stub.lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected points %v", stub.lines)
+	}
+}
+
+func TestInfluxBatch(t *testing.T) {
+	stub := &influxStub{}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	db, err := NewInflux(InfluxConfig{URL: srv.URL, Database: "evcc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < influxBatchSize+1; i++ {
+		db.Put(SocketValue{"lp1", "gridPower", float64(i)}, time.Now())
+	}
+
+	if err := db.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stub.reqs) != 2 || len(stub.lines) != influxBatchSize+1 {
+		t.Errorf("expected 2 requests with %d points, got %d with %d", influxBatchSize+1, len(stub.reqs), len(stub.lines))
+	}
+}
+
+func TestInfluxFlushLoop(t *testing.T) {
+	db, err := NewInflux(InfluxConfig{URL: "http://localhost", Database: "evcc", Interval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		db.flushLoop(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("expected flush loop to stop when context is done")
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/andig/evcc/api"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics exports published loadpoint values as Prometheus metrics
+type Metrics struct {
+	mux           sync.Mutex
+	gauges        map[string]*prometheus.GaugeVec
+	enabled       *prometheus.GaugeVec
+	status        *prometheus.GaugeVec
+	mode          *prometheus.GaugeVec
+	chargedEnergy *prometheus.CounterVec
+
+	// last session energy per loadpoint for counting energy increments
+	sessionEnergy map[string]float64
+}
+
+func newGaugeVec(name, help string, labels ...string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "evcc",
+		Name:      name,
+		Help:      help,
+	}, append([]string{"loadpoint"}, labels...))
+}
+
+// NewMetrics creates loadpoint metrics and registers them with registerer
+func NewMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		gauges: map[string]*prometheus.GaugeVec{
+			"gridPower":     newGaugeVec("grid_power_watts", "Grid power, negative when exporting"),
+			"pvPower":       newGaugeVec("pv_power_watts", "PV generation power"),
+			"chargePower":   newGaugeVec("charge_power_watts", "Charge power"),
+			"chargeCurrent": newGaugeVec("charge_current_amperes", "Actual charge current"),
+			"targetCurrent": newGaugeVec("target_current_amperes", "Target charge current determined by charge mode"),
+		},
+		enabled: newGaugeVec("charger_enabled", "Charger enabled state"),
+		status:  newGaugeVec("charger_status", "Charger status, 1 for current status", "status"),
+		mode:    newGaugeVec("charge_mode", "Charge mode, 1 for current mode", "mode"),
+		chargedEnergy: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "evcc",
+			Name:      "charged_energy_watthours_total",
+			Help:      "Charged energy",
+		}, []string{"loadpoint"}),
+		sessionEnergy: make(map[string]float64),
+	}
+
+	collectors := []prometheus.Collector{m.enabled, m.status, m.mode, m.chargedEnergy}
+	for _, g := range m.gauges {
+		collectors = append(collectors, g)
+	}
+
+	for _, c := range collectors {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Run updates metrics from the input channel's values and forwards them
+func (m *Metrics) Run(in <-chan SocketValue) <-chan SocketValue {
+	out := make(chan SocketValue)
+
+	go func() {
+		for v := range in {
+			m.Update(v)
+			out <- v
+		}
+		close(out)
+	}()
+
+	return out
+}
+
+// oneHot sets the gauge for the active label value to 1 and all others to 0
+func oneHot(g *prometheus.GaugeVec, loadPoint, active string, values []string) {
+	for _, v := range values {
+		val := 0.0
+		if v == active {
+			val = 1
+		}
+		g.WithLabelValues(loadPoint, v).Set(val)
+	}
+}
+
+// Update applies a single value to the metrics
+func (m *Metrics) Update(v SocketValue) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if g, ok := m.gauges[v.Key]; ok {
+		if f, ok := toFloat(v.Val); ok {
+			g.WithLabelValues(v.LoadPoint).Set(f)
+		}
+		return
+	}
+
+	switch v.Key {
+	case "enabled":
+		if b, ok := v.Val.(bool); ok {
+			val := 0.0
+			if b {
+				val = 1
+			}
+			m.enabled.WithLabelValues(v.LoadPoint).Set(val)
+		}
+
+	case "status":
+		if s, ok := v.Val.(string); ok {
+			oneHot(m.status, v.LoadPoint, s, []string{
+				string(api.StatusA), string(api.StatusB), string(api.StatusC),
+				string(api.StatusD), string(api.StatusE), string(api.StatusF),
+			})
+		}
+
+	case "mode":
+		if s, ok := v.Val.(string); ok {
+			oneHot(m.mode, v.LoadPoint, s, []string{
+				string(api.ModeOff), string(api.ModeNow), string(api.ModeMinPV), string(api.ModePV), string(api.ModeCheap), string(api.ModeClean),
+				string(api.ModeFeedInLimit),
+			})
+		}
+
+	case "chargedEnergy":
+		if f, ok := toFloat(v.Val); ok {
+			// session energy restarts from zero on new session
+			delta := f - m.sessionEnergy[v.LoadPoint]
+			if f < m.sessionEnergy[v.LoadPoint] {
+				delta = f
+			}
+			m.sessionEnergy[v.LoadPoint] = f
+
+			if delta > 0 {
+				m.chargedEnergy.WithLabelValues(v.LoadPoint).Add(delta)
+			}
+		}
+	}
+}
+
+// toFloat converts numeric values to float64
+func toFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	m, err := NewMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []SocketValue{
+		{"lp1", "gridPower", -1150.0},
+		{"lp1", "targetCurrent", int64(10)},
+		{"lp1", "enabled", true},
+		{"lp1", "status", "C"},
+		{"lp1", "mode", "pv"},
+		{"lp1", "chargedEnergy", 1000.0},
+		{"lp1", "chargedEnergy", 1500.0},
+		{"lp1", "chargedEnergy", 200.0}, // new session
+	} {
+		m.Update(v)
+	}
+
+	cases := []struct {
+		collector prometheus.Collector
+		expected  float64
+	}{
+		{m.gauges["gridPower"].WithLabelValues("lp1"), -1150},
+		{m.gauges["targetCurrent"].WithLabelValues("lp1"), 10},
+		{m.enabled.WithLabelValues("lp1"), 1},
+		{m.status.WithLabelValues("lp1", "C"), 1},
+		{m.status.WithLabelValues("lp1", "A"), 0},
+		{m.mode.WithLabelValues("lp1", "pv"), 1},
+		{m.mode.WithLabelValues("lp1", "now"), 0},
+		{m.chargedEnergy.WithLabelValues("lp1"), 1700},
+	}
+
+	for _, c := range cases {
+		if f := testutil.ToFloat64(c.collector); f != c.expected {
+			t.Errorf("expected %.0f, got %.0f", c.expected, f)
+		}
+	}
+}
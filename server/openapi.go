@@ -0,0 +1,484 @@
+package server
+
+// openAPISpec describes the REST API served below /api.
+// It must be kept in sync with the routes in newRouter, see openapi_test.go.
+const openAPISpec = `{
+  "openapi": "3.0.2",
+  "info": {
+    "title": "evcc",
+    "description": "EV Charge Controller API. All PUT operations also accept POST. If authentication is configured, GET operations require the readonly role and PUT operations require the admin role.",
+    "version": "1"
+  },
+  "servers": [
+    { "url": "/api" }
+  ],
+  "security": [
+    { "bearerAuth": [] },
+    { "cookieAuth": [] }
+  ],
+  "paths": {
+    "/openapi.json": {
+      "get": {
+        "summary": "API specification",
+        "operationId": "getOpenAPI",
+        "security": [],
+        "responses": {
+          "200": {
+            "description": "OpenAPI document",
+            "content": { "application/json": { "schema": { "type": "object" } } }
+          }
+        }
+      }
+    },
+    "/auth": {
+      "get": {
+        "summary": "Authentication status of the request",
+        "operationId": "getAuth",
+        "security": [],
+        "responses": {
+          "200": { "$ref": "#/components/responses/Auth" }
+        }
+      }
+    },
+    "/auth/login": {
+      "post": {
+        "summary": "Login with user credentials, creates session cookie",
+        "operationId": "login",
+        "security": [],
+        "requestBody": {
+          "required": true,
+          "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Login" } } }
+        },
+        "responses": {
+          "200": { "$ref": "#/components/responses/Auth" },
+          "400": { "$ref": "#/components/responses/Error" },
+          "401": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/auth/logout": {
+      "post": {
+        "summary": "Logout, removes session cookie",
+        "operationId": "logout",
+        "security": [],
+        "responses": {
+          "200": { "$ref": "#/components/responses/Auth" }
+        }
+      }
+    },
+    "/state": {
+      "get": {
+        "summary": "Settings and latest values of all loadpoints",
+        "operationId": "getState",
+        "responses": {
+          "200": {
+            "description": "Loadpoint states",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": { "$ref": "#/components/schemas/LoadPointState" }
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    "/sessions": {
+      "get": {
+        "summary": "Finished charge sessions",
+        "operationId": "getSessions",
+        "parameters": [
+          { "$ref": "#/components/parameters/SessionLoadPoint" },
+          { "$ref": "#/components/parameters/SessionVehicle" },
+          { "$ref": "#/components/parameters/SessionFrom" },
+          { "$ref": "#/components/parameters/SessionTo" }
+        ],
+        "responses": {
+          "200": {
+            "description": "Charge sessions in order of creation",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": { "$ref": "#/components/schemas/Session" }
+                }
+              }
+            }
+          },
+          "400": { "$ref": "#/components/responses/Error" },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/sessions.csv": {
+      "get": {
+        "summary": "Export finished charge sessions as CSV",
+        "operationId": "exportSessions",
+        "parameters": [
+          { "$ref": "#/components/parameters/SessionLoadPoint" },
+          { "$ref": "#/components/parameters/SessionVehicle" },
+          { "$ref": "#/components/parameters/SessionFrom" },
+          { "$ref": "#/components/parameters/SessionTo" }
+        ],
+        "responses": {
+          "200": {
+            "description": "Charge sessions with energy in kWh",
+            "content": { "text/csv": { "schema": { "type": "string" } } }
+          },
+          "400": { "$ref": "#/components/responses/Error" },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/mode": {
+      "get": {
+        "summary": "Charge mode of the first loadpoint",
+        "operationId": "getMode",
+        "responses": {
+          "200": { "$ref": "#/components/responses/ChargeMode" }
+        }
+      }
+    },
+    "/mode/{mode}": {
+      "put": {
+        "summary": "Set charge mode of the first loadpoint",
+        "operationId": "setMode",
+        "parameters": [
+          { "$ref": "#/components/parameters/Mode" }
+        ],
+        "responses": {
+          "200": { "$ref": "#/components/responses/ChargeMode" },
+          "400": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/loadpoints/{loadpoint}/mode/{mode}": {
+      "put": {
+        "summary": "Set charge mode",
+        "operationId": "setLoadPointMode",
+        "parameters": [
+          { "$ref": "#/components/parameters/LoadPoint" },
+          { "$ref": "#/components/parameters/Mode" }
+        ],
+        "responses": {
+          "200": { "$ref": "#/components/responses/ChargeMode" },
+          "400": { "$ref": "#/components/responses/Error" },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/loadpoints/{loadpoint}/mincurrent/{value}": {
+      "put": {
+        "summary": "Set minimum charge current in A",
+        "operationId": "setMinCurrent",
+        "parameters": [
+          { "$ref": "#/components/parameters/LoadPoint" },
+          { "$ref": "#/components/parameters/Value" }
+        ],
+        "responses": {
+          "200": { "$ref": "#/components/responses/Setting" },
+          "400": { "$ref": "#/components/responses/Error" },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/loadpoints/{loadpoint}/maxcurrent/{value}": {
+      "put": {
+        "summary": "Set maximum charge current in A",
+        "operationId": "setMaxCurrent",
+        "parameters": [
+          { "$ref": "#/components/parameters/LoadPoint" },
+          { "$ref": "#/components/parameters/Value" }
+        ],
+        "responses": {
+          "200": { "$ref": "#/components/responses/Setting" },
+          "400": { "$ref": "#/components/responses/Error" },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/loadpoints/{loadpoint}/phases/{value}": {
+      "put": {
+        "summary": "Set number of phases",
+        "operationId": "setPhases",
+        "parameters": [
+          { "$ref": "#/components/parameters/LoadPoint" },
+          { "$ref": "#/components/parameters/Value" }
+        ],
+        "responses": {
+          "200": { "$ref": "#/components/responses/Setting" },
+          "400": { "$ref": "#/components/responses/Error" },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/loadpoints/{loadpoint}/targetsoc/{value}": {
+      "put": {
+        "summary": "Set target state of charge in %",
+        "operationId": "setTargetSoC",
+        "parameters": [
+          { "$ref": "#/components/parameters/LoadPoint" },
+          { "$ref": "#/components/parameters/Value" }
+        ],
+        "responses": {
+          "200": { "$ref": "#/components/responses/Setting" },
+          "400": { "$ref": "#/components/responses/Error" },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/loadpoints/{loadpoint}/schedule": {
+      "get": {
+        "summary": "Weekly charge mode schedule",
+        "operationId": "getSchedule",
+        "parameters": [
+          { "$ref": "#/components/parameters/LoadPoint" }
+        ],
+        "responses": {
+          "200": { "$ref": "#/components/responses/Schedule" },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      },
+      "put": {
+        "summary": "Replace weekly charge mode schedule",
+        "operationId": "setSchedule",
+        "parameters": [
+          { "$ref": "#/components/parameters/LoadPoint" }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Schedule" } } }
+        },
+        "responses": {
+          "200": { "$ref": "#/components/responses/Schedule" },
+          "400": { "$ref": "#/components/responses/Error" },
+          "404": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    },
+    "/loadpoints/{loadpoint}/forecast": {
+      "get": {
+        "summary": "PV production forecast and energy expected to be available for charging",
+        "operationId": "getForecast",
+        "parameters": [
+          { "$ref": "#/components/parameters/LoadPoint" }
+        ],
+        "responses": {
+          "200": {
+            "description": "Forecast",
+            "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Forecast" } } }
+          },
+          "404": { "$ref": "#/components/responses/Error" },
+          "500": { "$ref": "#/components/responses/Error" }
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "bearerAuth": { "type": "http", "scheme": "bearer" },
+      "cookieAuth": { "type": "apiKey", "in": "cookie", "name": "evcc_session" }
+    },
+    "parameters": {
+      "LoadPoint": {
+        "name": "loadpoint",
+        "in": "path",
+        "required": true,
+        "schema": { "type": "string" }
+      },
+      "Mode": {
+        "name": "mode",
+        "in": "path",
+        "required": true,
+        "schema": { "$ref": "#/components/schemas/Mode" }
+      },
+      "SessionLoadPoint": {
+        "name": "loadpoint",
+        "in": "query",
+        "schema": { "type": "string" }
+      },
+      "SessionVehicle": {
+        "name": "vehicle",
+        "in": "query",
+        "schema": { "type": "string" }
+      },
+      "SessionFrom": {
+        "name": "from",
+        "in": "query",
+        "description": "Sessions started at or after date (YYYY-MM-DD) or RFC3339 time",
+        "schema": { "type": "string" }
+      },
+      "SessionTo": {
+        "name": "to",
+        "in": "query",
+        "description": "Sessions started on or before date (YYYY-MM-DD) or before RFC3339 time",
+        "schema": { "type": "string" }
+      },
+      "Value": {
+        "name": "value",
+        "in": "path",
+        "required": true,
+        "schema": { "type": "integer", "format": "int64", "minimum": 0 }
+      }
+    },
+    "responses": {
+      "Auth": {
+        "description": "Authentication status",
+        "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Auth" } } }
+      },
+      "ChargeMode": {
+        "description": "Charge mode",
+        "content": { "application/json": { "schema": { "$ref": "#/components/schemas/ChargeMode" } } }
+      },
+      "Schedule": {
+        "description": "Charge mode schedule",
+        "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Schedule" } } }
+      },
+      "Setting": {
+        "description": "Updated setting",
+        "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Setting" } } }
+      },
+      "Error": {
+        "description": "Error",
+        "content": { "application/json": { "schema": { "$ref": "#/components/schemas/Error" } } }
+      }
+    },
+    "schemas": {
+      "Auth": {
+        "type": "object",
+        "required": ["enabled", "role"],
+        "properties": {
+          "enabled": { "type": "boolean" },
+          "role": { "type": "string", "enum": ["", "readonly", "admin"] }
+        }
+      },
+      "Login": {
+        "type": "object",
+        "required": ["name", "password"],
+        "properties": {
+          "name": { "type": "string" },
+          "password": { "type": "string" }
+        }
+      },
+      "Mode": {
+        "type": "string",
+        "enum": ["off", "now", "minpv", "pv", "cheap", "clean", "feedinlimit"]
+      },
+      "ChargeMode": {
+        "type": "object",
+        "required": ["mode"],
+        "properties": {
+          "mode": { "$ref": "#/components/schemas/Mode" }
+        }
+      },
+      "Setting": {
+        "type": "object",
+        "required": ["value"],
+        "properties": {
+          "value": { "type": "integer", "format": "int64" }
+        }
+      },
+      "Error": {
+        "type": "object",
+        "required": ["error"],
+        "properties": {
+          "error": { "type": "string" }
+        }
+      },
+      "Session": {
+        "type": "object",
+        "required": ["id", "loadpoint", "start", "end", "energy", "maxCurrent"],
+        "properties": {
+          "id": { "type": "integer", "format": "int64" },
+          "loadpoint": { "type": "string" },
+          "vehicle": { "type": "string" },
+          "start": { "type": "string", "format": "date-time" },
+          "end": { "type": "string", "format": "date-time" },
+          "energy": { "type": "number", "description": "Wh" },
+          "maxCurrent": { "type": "integer", "format": "int64", "description": "A" },
+          "solarPercentage": { "type": "number", "description": "%, share of energy charged from pv surplus" },
+          "cost": { "type": "number" },
+          "savings": { "type": "number", "description": "compared to charging from grid only" },
+          "currency": { "type": "string" },
+          "co2": { "type": "number", "description": "g, emissions of energy charged from grid" }
+        }
+      },
+      "Schedule": {
+        "type": "object",
+        "properties": {
+          "mode": { "$ref": "#/components/schemas/Mode", "description": "outside of entries, unchanged if empty" },
+          "entries": {
+            "type": "array",
+            "description": "matched in order",
+            "items": {
+              "type": "object",
+              "required": ["from", "to", "mode"],
+              "properties": {
+                "days": {
+                  "type": "array",
+                  "description": "days the window starts on, every day if empty",
+                  "items": { "type": "string", "enum": ["mon", "tue", "wed", "thu", "fri", "sat", "sun"] }
+                },
+                "from": { "type": "string", "description": "hh:mm" },
+                "to": { "type": "string", "description": "hh:mm, may extend over midnight" },
+                "mode": { "$ref": "#/components/schemas/Mode" }
+              }
+            }
+          }
+        }
+      },
+      "Forecast": {
+        "type": "object",
+        "required": ["energy", "required", "horizon", "slots"],
+        "properties": {
+          "energy": { "type": "number", "description": "Wh, forecast pv energy available for charging within horizon" },
+          "required": { "type": "number", "description": "Wh, energy required per session" },
+          "horizon": { "type": "number", "description": "s" },
+          "slots": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "required": ["start", "end", "power"],
+              "properties": {
+                "start": { "type": "string", "format": "date-time" },
+                "end": { "type": "string", "format": "date-time" },
+                "power": { "type": "number", "description": "W" }
+              }
+            }
+          }
+        }
+      },
+      "LoadPointState": {
+        "type": "object",
+        "required": ["name", "mode", "minCurrent", "maxCurrent", "phases", "targetSoC"],
+        "properties": {
+          "name": { "type": "string" },
+          "mode": { "$ref": "#/components/schemas/Mode" },
+          "minCurrent": { "type": "integer", "format": "int64", "description": "A" },
+          "maxCurrent": { "type": "integer", "format": "int64", "description": "A" },
+          "phases": { "type": "number" },
+          "targetSoC": { "type": "integer", "format": "int64", "description": "%" },
+          "gridPower": { "type": "number", "description": "W, negative when exporting" },
+          "pvPower": { "type": "number", "description": "W" },
+          "chargePower": { "type": "number", "description": "W" },
+          "chargeCurrent": { "type": "integer", "format": "int64", "description": "A" },
+          "targetCurrent": { "type": "integer", "format": "int64", "description": "A, determined by charge mode" },
+          "chargedEnergy": { "type": "number", "description": "Wh" },
+          "chargeDuration": { "type": "number", "description": "s" },
+          "socCharge": { "type": "number", "description": "%, vehicle state of charge if available" },
+          "solarPercentage": { "type": "number", "description": "%, share of session energy charged from pv surplus" },
+          "chargeCost": { "type": "number", "description": "session energy cost" },
+          "chargeSavings": { "type": "number", "description": "session savings compared to charging from grid only" },
+          "currency": { "type": "string" },
+          "chargeCO2": { "type": "number", "description": "g, session emissions of energy charged from grid" },
+          "status": { "type": "string", "enum": ["", "A", "B", "C", "D", "E", "F"] },
+          "enabled": { "type": "boolean", "description": "intended state in dry run" },
+          "dryRun": { "type": "boolean", "description": "charger changes are logged instead of applied" }
+        }
+      }
+    }
+  }
+}
+`
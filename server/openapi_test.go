@@ -0,0 +1,283 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andig/evcc/api"
+	"github.com/andig/evcc/core"
+	"github.com/gorilla/mux"
+)
+
+type openAPIDocument struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Responses map[string]openAPIResponse `json:"responses"`
+		Schemas   map[string]openAPISchema   `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIResponse struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema openAPISchema `json:"schema"`
+	} `json:"content"`
+}
+
+type openAPISchema struct {
+	Ref        string                   `json:"$ref"`
+	Type       string                   `json:"type"`
+	Enum       []interface{}            `json:"enum"`
+	Required   []string                 `json:"required"`
+	Properties map[string]openAPISchema `json:"properties"`
+	Items      *openAPISchema           `json:"items"`
+}
+
+// stubCharger is an enabled charger with connected vehicle
+type stubCharger struct{}
+
+func (c *stubCharger) Status() (api.ChargeStatus, error) { return api.StatusC, nil }
+func (c *stubCharger) Enabled() (bool, error)            { return true, nil }
+func (c *stubCharger) Enable(enable bool) error          { return nil }
+func (c *stubCharger) ActualCurrent() (int64, error)     { return 16, nil }
+
+func loadSpec(t *testing.T) openAPIDocument {
+	var doc openAPIDocument
+	if err := json.Unmarshal([]byte(openAPISpec), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// routeTemplate converts mux path template into OpenAPI path
+func routeTemplate(tmpl string) string {
+	re := regexp.MustCompile(`{(\w+):[^}]+}`)
+	return re.ReplaceAllString(strings.TrimPrefix(tmpl, "/api"), "{$1}")
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := loadSpec(t)
+
+	lp := core.NewLoadPoint("lp1", &stubCharger{})
+	router := newRouter([]*core.LoadPoint{lp}, nil, NewCache(), nil, &Auth{})
+
+	routes := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(tmpl, "/api/") {
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		var put bool
+		for _, method := range methods {
+			put = put || method == "PUT"
+		}
+
+		path := routeTemplate(tmpl)
+		for _, method := range methods {
+			// POST and OPTIONS are aliases of PUT
+			if method == "OPTIONS" || method == "POST" && put {
+				continue
+			}
+
+			method = strings.ToLower(method)
+			routes[method+" "+path] = true
+
+			if _, ok := doc.Paths[path][method]; !ok {
+				t.Errorf("route %s %s missing from specification", method, path)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if !routes[method+" "+path] {
+				t.Errorf("specified operation %s %s not routed", method, path)
+			}
+		}
+	}
+}
+
+// validate checks val against schema
+func validate(doc openAPIDocument, schema openAPISchema, val interface{}) error {
+	if schema.Ref != "" {
+		return validate(doc, doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")], val)
+	}
+
+	if len(schema.Enum) > 0 {
+		var found bool
+		for _, e := range schema.Enum {
+			found = found || e == val
+		}
+		if !found {
+			return fmt.Errorf("invalid enum value %v", val)
+		}
+	}
+
+	switch schema.Type {
+	case "object":
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected object, got %v", val)
+		}
+		for _, key := range schema.Required {
+			if _, ok := obj[key]; !ok {
+				return fmt.Errorf("missing required property %s", key)
+			}
+		}
+		if schema.Properties == nil {
+			return nil
+		}
+		for key, v := range obj {
+			prop, ok := schema.Properties[key]
+			if !ok {
+				return fmt.Errorf("undocumented property %s", key)
+			}
+			if err := validate(doc, prop, v); err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+		}
+	case "array":
+		arr, ok := val.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected array, got %v", val)
+		}
+		for _, v := range arr {
+			if err := validate(doc, *schema.Items, v); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := val.(string); !ok {
+			return fmt.Errorf("expected string, got %v", val)
+		}
+	case "number", "integer":
+		f, ok := val.(float64)
+		if !ok {
+			return fmt.Errorf("expected %s, got %v", schema.Type, val)
+		}
+		if schema.Type == "integer" && f != float64(int64(f)) {
+			return fmt.Errorf("expected integer, got %v", val)
+		}
+	case "boolean":
+		if _, ok := val.(bool); !ok {
+			return fmt.Errorf("expected boolean, got %v", val)
+		}
+	}
+
+	return nil
+}
+
+func TestOpenAPIResponses(t *testing.T) {
+	doc := loadSpec(t)
+
+	lp := core.NewLoadPoint("lp1", &stubCharger{})
+
+	cache := NewCache()
+	for _, v := range []SocketValue{
+		{"lp1", "gridPower", -1150.0},
+		{"lp1", "pvPower", 3450.0},
+		{"lp1", "chargePower", 2300.0},
+		{"lp1", "chargeCurrent", int64(10)},
+		{"lp1", "targetCurrent", int64(10)},
+		{"lp1", "chargedEnergy", 1000.0},
+		{"lp1", "chargeDuration", lp.ChargeDuration()},
+		{"lp1", "socCharge", 61.5},
+		{"lp1", "solarPercentage", 72.0},
+		{"lp1", "chargeCost", 4.1},
+		{"lp1", "chargeSavings", 2.5},
+		{"lp1", "currency", "EUR"},
+		{"lp1", "chargeCO2", 1250.0},
+		{"lp1", "status", string(api.StatusC)},
+		{"lp1", "enabled", true},
+		{"lp1", "dryRun", false},
+	} {
+		cache.Put(v)
+	}
+
+	sessions := &testSessions{}
+	_ = sessions.AddSession(core.Session{LoadPoint: "lp1", Vehicle: "Zoe", Start: time.Now(), End: time.Now(), Energy: 2500, MaxCurrent: 16, SolarPercentage: 72, Cost: 0.21, Savings: 0.4, Currency: "EUR"})
+
+	router := newRouter([]*core.LoadPoint{lp}, nil, cache, sessions, &Auth{})
+
+	cases := []struct {
+		method, uri, path string
+		status            int
+	}{
+		{"GET", "/api/openapi.json", "/openapi.json", 200},
+		{"GET", "/api/auth", "/auth", 200},
+		{"POST", "/api/auth/login", "/auth/login", 400},
+		{"POST", "/api/auth/logout", "/auth/logout", 200},
+		{"GET", "/api/state", "/state", 200},
+		{"GET", "/api/mode", "/mode", 200},
+		{"GET", "/api/sessions?loadpoint=lp1&from=2019-10-01", "/sessions", 200},
+		{"GET", "/api/sessions?to=invalid", "/sessions", 400},
+		{"PUT", "/api/mode/now", "/mode/{mode}", 200},
+		{"PUT", "/api/mode/pv", "/mode/{mode}", 400},
+		{"PUT", "/api/mode/bogus", "/mode/{mode}", 400},
+		{"PUT", "/api/loadpoints/lp1/mode/now", "/loadpoints/{loadpoint}/mode/{mode}", 200},
+		{"PUT", "/api/loadpoints/lp2/mode/now", "/loadpoints/{loadpoint}/mode/{mode}", 404},
+		{"PUT", "/api/loadpoints/lp1/mincurrent/6", "/loadpoints/{loadpoint}/mincurrent/{value}", 200},
+		{"PUT", "/api/loadpoints/lp1/mincurrent/0", "/loadpoints/{loadpoint}/mincurrent/{value}", 400},
+		{"PUT", "/api/loadpoints/lp1/maxcurrent/32", "/loadpoints/{loadpoint}/maxcurrent/{value}", 200},
+		{"PUT", "/api/loadpoints/lp1/phases/3", "/loadpoints/{loadpoint}/phases/{value}", 200},
+		{"PUT", "/api/loadpoints/lp1/targetsoc/80", "/loadpoints/{loadpoint}/targetsoc/{value}", 200},
+	}
+
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(c.method, c.uri, nil))
+
+		if w.Code != c.status {
+			t.Errorf("%s %s: expected status %d, got %d", c.method, c.uri, c.status, w.Code)
+			continue
+		}
+
+		op, ok := doc.Paths[c.path][strings.ToLower(c.method)]
+		if !ok {
+			t.Errorf("%s %s: missing operation", c.method, c.path)
+			continue
+		}
+
+		res, ok := op.Responses[strconv.Itoa(c.status)]
+		if !ok {
+			t.Errorf("%s %s: undocumented status %d", c.method, c.uri, c.status)
+			continue
+		}
+		if res.Ref != "" {
+			res = doc.Components.Responses[strings.TrimPrefix(res.Ref, "#/components/responses/")]
+		}
+
+		var body interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s %s: %v", c.method, c.uri, err)
+			continue
+		}
+
+		if err := validate(doc, res.Content["application/json"].Schema, body); err != nil {
+			t.Errorf("%s %s: %v", c.method, c.uri, err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/andig/evcc/core"
+)
+
+// ScheduleHandler returns the loadpoint's charge mode schedule
+func ScheduleHandler(lp *core.LoadPoint) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, http.StatusOK, lp.Schedule())
+	}
+}
+
+// SetScheduleHandler replaces the loadpoint's charge mode schedule
+func SetScheduleHandler(lp *core.LoadPoint) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var schedule core.Schedule
+		if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+			jsonError(w, http.StatusBadRequest, fmt.Errorf("invalid schedule: %v", err))
+			return
+		}
+
+		if err := lp.SetSchedule(schedule); err != nil {
+			jsonError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		jsonResponse(w, http.StatusOK, lp.Schedule())
+	}
+}
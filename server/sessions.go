@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/andig/evcc/core"
+)
+
+const dateFormat = "2006-01-02"
+
+// parseTime parses RFC3339 timestamps or local dates. Dates used as end
+// of range include the entire day.
+func parseTime(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.ParseInLocation(dateFormat, s, time.Local); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// sessionFilter creates session filter from request query
+func sessionFilter(r *http.Request) (core.SessionFilter, error) {
+	q := r.URL.Query()
+
+	from, err := parseTime(q.Get("from"), false)
+	if err != nil {
+		return core.SessionFilter{}, fmt.Errorf("invalid from: %v", err)
+	}
+
+	to, err := parseTime(q.Get("to"), true)
+	if err != nil {
+		return core.SessionFilter{}, fmt.Errorf("invalid to: %v", err)
+	}
+
+	return core.SessionFilter{
+		LoadPoint: q.Get("loadpoint"),
+		Vehicle:   q.Get("vehicle"),
+		From:      from,
+		To:        to,
+	}, nil
+}
+
+// sessionsHandler resolves the sessions selected by the request
+func sessionsHandler(store core.SessionStore, handler func(http.ResponseWriter, []core.Session)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if store == nil {
+			jsonError(w, http.StatusNotFound, errors.New("session log not configured"))
+			return
+		}
+
+		filter, err := sessionFilter(r)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		sessions, err := store.Sessions(filter)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		handler(w, sessions)
+	}
+}
+
+// SessionsHandler returns charge sessions filtered by loadpoint, vehicle and start time
+func SessionsHandler(store core.SessionStore) http.HandlerFunc {
+	return sessionsHandler(store, func(w http.ResponseWriter, sessions []core.Session) {
+		jsonResponse(w, http.StatusOK, sessions)
+	})
+}
+
+// SessionsCSVHandler exports charge sessions filtered by loadpoint, vehicle and start time as CSV
+func SessionsCSVHandler(store core.SessionStore) http.HandlerFunc {
+	return sessionsHandler(store, func(w http.ResponseWriter, sessions []core.Session) {
+		w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="sessions.csv"`)
+		w.WriteHeader(http.StatusOK)
+
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"id", "loadpoint", "vehicle", "start", "end", "duration (min)", "energy (kWh)", "max current (A)", "solar (%)", "cost", "savings", "currency", "co2 (kg)"})
+
+		for _, s := range sessions {
+			_ = cw.Write([]string{
+				strconv.FormatUint(s.ID, 10),
+				s.LoadPoint,
+				s.Vehicle,
+				s.Start.Local().Format(time.RFC3339),
+				s.End.Local().Format(time.RFC3339),
+				strconv.FormatFloat(s.End.Sub(s.Start).Minutes(), 'f', 0, 64),
+				strconv.FormatFloat(s.Energy/1e3, 'f', 3, 64),
+				strconv.FormatInt(s.MaxCurrent, 10),
+				strconv.FormatFloat(s.SolarPercentage, 'f', 0, 64),
+				strconv.FormatFloat(s.Cost, 'f', 2, 64),
+				strconv.FormatFloat(s.Savings, 'f', 2, 64),
+				s.Currency,
+				strconv.FormatFloat(s.CO2/1e3, 'f', 3, 64),
+			})
+		}
+
+		cw.Flush()
+	})
+}
@@ -1,29 +1,60 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/andig/evcc/api"
+	"github.com/andig/evcc/core"
 	"github.com/gorilla/websocket"
 )
 
 const (
 	// Time allowed to write a message to the peer
 	writeTimeout = 10 * time.Second
+
+	// Maximum message size allowed from peer
+	maxMessageSize = 512
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true },
+// SocketValue is a single loadpoint-scoped value pushed to the clients
+type SocketValue struct {
+	LoadPoint string
+	Key       string
+	Val       interface{}
 }
 
-type SocketValue struct {
-	Key string
-	Val interface{}
+// socketMessage is the JSON representation of a SocketValue
+type socketMessage struct {
+	LoadPoint string      `json:"loadpoint,omitempty"`
+	Key       string      `json:"key"`
+	Val       interface{} `json:"val"`
+	TS        time.Time   `json:"ts"`
+}
+
+// socketCommand is a client request to change loadpoint settings
+type socketCommand struct {
+	ID        int64           `json:"id"`
+	LoadPoint string          `json:"loadpoint"`
+	Cmd       string          `json:"cmd"`
+	Val       json.RawMessage `json:"val"`
+}
+
+// socketAck acknowledges a socketCommand
+type socketAck struct {
+	ID    int64  `json:"id"`
+	Ack   bool   `json:"ack"`
+	Error string `json:"error,omitempty"`
+}
+
+// socketReply is an outbound message for a single client
+type socketReply struct {
+	client  *SocketClient
+	message []byte
 }
 
 // SocketClient is a middleman between the websocket connection and the hub.
@@ -33,6 +64,9 @@ type SocketClient struct {
 	// The websocket connection.
 	conn *websocket.Conn
 
+	// Role of the authenticated connection.
+	role Role
+
 	// Buffered channel of outbound messages.
 	send chan []byte
 }
@@ -44,28 +78,57 @@ func (c *SocketClient) writePump() {
 	}()
 
 	for {
-		msg := <-c.send
+		msg, ok := <-c.send
 		if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
 			return
 		}
+		if !ok {
+			// hub closed the channel
+			_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+		}
 		if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
 			return
 		}
 	}
 }
 
+// readPump pumps commands from the websocket connection to the loadpoints.
+// It unregisters the client when the connection is closed.
+func (c *SocketClient) readPump() {
+	defer func() {
+		c.hub.unregister <- c
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("socket: read error: %v", err)
+			}
+			return
+		}
+
+		c.hub.reply(c, c.hub.handle(c.role, msg))
+	}
+}
+
 // ServeWebsocket handles websocket requests from the peer.
-func ServeWebsocket(hub *SocketHub, w http.ResponseWriter, r *http.Request) {
+func ServeWebsocket(hub *SocketHub, upgrader *websocket.Upgrader, w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	client := &SocketClient{hub: hub, conn: conn, send: make(chan []byte, 256)}
+	client := &SocketClient{hub: hub, conn: conn, role: RoleFromContext(r.Context()), send: make(chan []byte, 256)}
 	client.hub.register <- client
 
-	// run writing to client in goroutine
+	// run writing to and reading from client in goroutines
 	go client.writePump()
+	go client.readPump()
 }
 
 // SocketHub maintains the set of active clients and broadcasts messages to the
@@ -79,49 +142,158 @@ type SocketHub struct {
 
 	// Unregister requests from clients.
 	unregister chan *SocketClient
+
+	// Messages for individual clients.
+	replies chan socketReply
+
+	// Loadpoints controlled by client commands.
+	loadPoints map[string]api.LoadPoint
+
+	// Latest values, sent to clients on connect.
+	cache *Cache
 }
 
 // NewSocketHub creates a web socket hub that distributes meter status and
 // query results for the ui or other clients
-func NewSocketHub() *SocketHub {
-	return &SocketHub{
+func NewSocketHub(loadPoints []*core.LoadPoint, cache *Cache) *SocketHub {
+	hub := &SocketHub{
 		register:   make(chan *SocketClient),
 		unregister: make(chan *SocketClient),
+		replies:    make(chan socketReply),
 		clients:    make(map[*SocketClient]bool),
+		loadPoints: make(map[string]api.LoadPoint),
+		cache:      cache,
+	}
+
+	for _, lp := range loadPoints {
+		hub.loadPoints[lp.Name] = lp
 	}
+
+	return hub
 }
 
-func (h *SocketHub) encode(v SocketValue) ([]byte, error) {
-	switch v.Val.(type) {
-	case int64:
-		s := fmt.Sprintf("{\"%s\": %d}", v.Key, v.Val)
-		return []byte(s), nil
-	case float64:
-		s := fmt.Sprintf("{\"%s\": %.3f}", v.Key, v.Val)
-		return []byte(s), nil
-	case string:
-		s := fmt.Sprintf("{\"%s\": \"%s\"}", v.Key, v.Val)
-		return []byte(s), nil
+// encode converts value into JSON message. Durations are encoded as seconds.
+func encode(v SocketValue, ts time.Time) ([]byte, error) {
+	val := v.Val
+	if d, ok := val.(time.Duration); ok {
+		val = d.Seconds()
 	}
 
-	return []byte{}, errors.New("encode: invalid format")
+	return json.Marshal(socketMessage{
+		LoadPoint: v.LoadPoint,
+		Key:       v.Key,
+		Val:       val,
+		TS:        ts,
+	})
 }
 
-func (h *SocketHub) broadcast(i SocketValue) {
-	if len(h.clients) > 0 {
-		message, err := h.encode(i)
+// handle executes client command and returns the encoded acknowledgement
+func (h *SocketHub) handle(role Role, msg []byte) []byte {
+	var cmd socketCommand
+	err := json.Unmarshal(msg, &cmd)
+
+	if err == nil && !role.allows(RoleAdmin) {
+		err = errors.New("forbidden")
+	}
+
+	if err == nil {
+		err = h.execute(cmd)
+	}
+
+	ack := socketAck{ID: cmd.ID, Ack: err == nil}
+	if err != nil {
+		ack.Error = err.Error()
+	}
+
+	b, err := json.Marshal(ack)
+	if err != nil {
+		log.Printf("socket: failed to encode ack: %v", err)
+	}
+
+	return b
+}
+
+// execute applies client command to the addressed loadpoint
+func (h *SocketHub) execute(cmd socketCommand) error {
+	lp, ok := h.loadPoints[cmd.LoadPoint]
+	if !ok {
+		return fmt.Errorf("invalid loadpoint: %s", cmd.LoadPoint)
+	}
+
+	switch cmd.Cmd {
+	case "mode":
+		var mode string
+		if err := json.Unmarshal(cmd.Val, &mode); err != nil {
+			return fmt.Errorf("invalid mode: %v", err)
+		}
+		return lp.ChargeMode(api.ChargeMode(mode))
+
+	case "minCurrent", "maxCurrent", "phases", "targetSoC":
+		var val int64
+		if err := json.Unmarshal(cmd.Val, &val); err != nil {
+			return fmt.Errorf("invalid %s: %v", cmd.Cmd, err)
+		}
+
+		switch cmd.Cmd {
+		case "minCurrent":
+			return lp.SetMinCurrent(val)
+		case "maxCurrent":
+			return lp.SetMaxCurrent(val)
+		case "phases":
+			return lp.SetPhases(val)
+		default:
+			return lp.SetTargetSoC(val)
+		}
+	}
+
+	return fmt.Errorf("invalid command: %s", cmd.Cmd)
+}
+
+// reply queues message for single client
+func (h *SocketHub) reply(client *SocketClient, message []byte) {
+	if message != nil {
+		h.replies <- socketReply{client: client, message: message}
+	}
+}
+
+// send delivers message to client. Slow clients are dropped.
+func (h *SocketHub) send(client *SocketClient, message []byte) {
+	select {
+	case client.send <- message:
+	default:
+		close(client.send)
+		delete(h.clients, client)
+	}
+}
+
+// snapshot sends the latest known state to a newly registered client
+func (h *SocketHub) snapshot(client *SocketClient) {
+	if h.cache == nil {
+		return
+	}
+
+	for _, entry := range h.cache.entries() {
+		message, err := encode(entry.SocketValue, entry.TS)
 		if err != nil {
-			log.Fatal(err)
+			continue
 		}
 
-		for client := range h.clients {
-			select {
-			case client.send <- message:
-			default:
-				close(client.send)
-				delete(h.clients, client)
-			}
+		if _, ok := h.clients[client]; !ok {
+			return
 		}
+		h.send(client, message)
+	}
+}
+
+func (h *SocketHub) broadcast(i SocketValue) {
+	message, err := encode(i, time.Now())
+	if err != nil {
+		log.Printf("socket: failed to encode %s %s: %v", i.LoadPoint, i.Key, err)
+		return
+	}
+
+	for client := range h.clients {
+		h.send(client, message)
 	}
 }
 
@@ -131,11 +303,16 @@ func (h *SocketHub) Run(in <-chan SocketValue) {
 		select {
 		case client := <-h.register:
 			h.clients[client] = true
+			h.snapshot(client)
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
 				close(client.send)
 			}
+		case r := <-h.replies:
+			if _, ok := h.clients[r.client]; ok {
+				h.send(r.client, r.message)
+			}
 		case obj, ok := <-in:
 			if !ok {
 				return // break if channel closed
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/andig/evcc/core"
+)
+
+func TestEncode(t *testing.T) {
+	ts := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		v        SocketValue
+		expected string
+	}{
+		{SocketValue{"lp1", "chargeCurrent", int64(16)}, `{"loadpoint":"lp1","key":"chargeCurrent","val":16,"ts":"2020-01-01T12:00:00Z"}`},
+		{SocketValue{"lp1", "gridPower", -1150.5}, `{"loadpoint":"lp1","key":"gridPower","val":-1150.5,"ts":"2020-01-01T12:00:00Z"}`},
+		{SocketValue{"lp1", "enabled", true}, `{"loadpoint":"lp1","key":"enabled","val":true,"ts":"2020-01-01T12:00:00Z"}`},
+		{SocketValue{"lp1", "chargeDuration", 90 * time.Second}, `{"loadpoint":"lp1","key":"chargeDuration","val":90,"ts":"2020-01-01T12:00:00Z"}`},
+		{SocketValue{"lp1", "mode", `"quoted"`}, `{"loadpoint":"lp1","key":"mode","val":"\"quoted\"","ts":"2020-01-01T12:00:00Z"}`},
+		{SocketValue{"", "uri", "evcc"}, `{"key":"uri","val":"evcc","ts":"2020-01-01T12:00:00Z"}`},
+	}
+
+	for _, c := range cases {
+		b, err := encode(c.v, ts)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if s := string(b); s != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, s)
+		}
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+	if _, err := encode(SocketValue{"lp1", "invalid", make(chan int)}, time.Now()); err == nil {
+		t.Error("expected encoding error")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	in := make(chan SocketValue)
+	cache := NewCache()
+	hub := NewSocketHub(nil, cache)
+	go hub.Run(cache.Run(in))
+
+	in <- SocketValue{"lp1", "mode", "pv"}
+	in <- SocketValue{"lp1", "mode", "now"}
+	in <- SocketValue{"lp2", "mode", "off"}
+	in <- SocketValue{"lp2", "mode", "off"} // make sure previous value is processed
+
+	client := &SocketClient{hub: hub, send: make(chan []byte, 256)}
+	hub.register <- client
+
+	res := make(map[string]string)
+	for i := 0; i < 2; i++ {
+		var msg socketMessage
+		if err := json.Unmarshal(<-client.send, &msg); err != nil {
+			t.Fatal(err)
+		}
+		res[msg.LoadPoint] = msg.Val.(string)
+	}
+
+	if res["lp1"] != "now" || res["lp2"] != "off" {
+		t.Errorf("unexpected snapshot %v", res)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	lp := core.NewLoadPoint("lp1", nil)
+	hub := NewSocketHub([]*core.LoadPoint{lp}, nil)
+
+	cases := []struct {
+		cmd      string
+		expected string
+	}{
+		{`{"id":1,"loadpoint":"lp1","cmd":"minCurrent","val":6}`, `{"id":1,"ack":true}`},
+		{`{"id":2,"loadpoint":"lp1","cmd":"maxCurrent","val":32}`, `{"id":2,"ack":true}`},
+		{`{"id":3,"loadpoint":"lp1","cmd":"targetSoC","val":80}`, `{"id":3,"ack":true}`},
+		{`{"id":8,"loadpoint":"lp1","cmd":"phases","val":3}`, `{"id":8,"ack":true}`},
+		{`{"id":4,"loadpoint":"lp1","cmd":"minCurrent","val":64}`, `{"id":4,"ack":false,"error":"invalid min current: 64A"}`},
+		{`{"id":5,"loadpoint":"lp1","cmd":"maxCurrent","val":"foo"}`, `{"id":5,"ack":false,"error":"invalid maxCurrent: json: cannot unmarshal string into Go value of type int64"}`},
+		{`{"id":6,"loadpoint":"lp2","cmd":"minCurrent","val":6}`, `{"id":6,"ack":false,"error":"invalid loadpoint: lp2"}`},
+		{`{"id":7,"loadpoint":"lp1","cmd":"foo"}`, `{"id":7,"ack":false,"error":"invalid command: foo"}`},
+	}
+
+	for _, c := range cases {
+		if res := string(hub.handle(RoleAdmin, []byte(c.cmd))); res != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, res)
+		}
+	}
+
+	expected := `{"id":9,"ack":false,"error":"forbidden"}`
+	if res := string(hub.handle(RoleReadOnly, []byte(`{"id":9,"loadpoint":"lp1","cmd":"targetSoC","val":50}`))); res != expected {
+		t.Errorf("expected %s, got %s", expected, res)
+	}
+
+	if s := lp.Settings(); s.MinCurrent != 6 || s.MaxCurrent != 32 || s.Phases != 3 || s.TargetSoC != 80 {
+		t.Errorf("unexpected loadpoint settings %+v", s)
+	}
+}
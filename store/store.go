@@ -0,0 +1,125 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/andig/evcc/core"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	sessionBucket   = []byte("sessions")
+	loadPointBucket = []byte("loadpoints")
+)
+
+// Store persists evcc data in an embedded bbolt database
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the database file at path
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{sessionBucket, loadPointBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func itob(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
+
+// AddSession stores a finished charge session and assigns its ID
+func (s *Store) AddSession(session core.Session) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(sessionBucket)
+
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		session.ID = id
+
+		val, err := json.Marshal(session)
+		if err != nil {
+			return err
+		}
+
+		return b.Put(itob(id), val)
+	})
+}
+
+// Sessions returns the sessions selected by filter in order of creation
+func (s *Store) Sessions(filter core.SessionFilter) ([]core.Session, error) {
+	res := make([]core.Session, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionBucket).ForEach(func(k, v []byte) error {
+			var session core.Session
+			if err := json.Unmarshal(v, &session); err != nil {
+				return err
+			}
+
+			if filter.Match(session) {
+				res = append(res, session)
+			}
+
+			return nil
+		})
+	})
+
+	return res, err
+}
+
+// SaveState stores the loadpoint's runtime state
+func (s *Store) SaveState(loadPoint string, state core.State) error {
+	val, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(loadPointBucket).Put([]byte(loadPoint), val)
+	})
+}
+
+// LoadState returns the loadpoint's runtime state or nil if not saved
+func (s *Store) LoadState(loadPoint string) (*core.State, error) {
+	var state *core.State
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(loadPointBucket).Get([]byte(loadPoint))
+		if val == nil {
+			return nil
+		}
+
+		state = new(core.State)
+		return json.Unmarshal(val, state)
+	})
+
+	return state, err
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andig/evcc/core"
+)
+
+func TestSessions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "evcc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "evcc.db")
+	s, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2019, 10, 1, 18, 0, 0, 0, time.UTC)
+	for i, lp := range []string{"lp1", "lp2", "lp1"} {
+		session := core.Session{
+			LoadPoint: lp,
+			Vehicle:   "Zoe",
+			Start:     start.AddDate(0, 0, i),
+			End:       start.AddDate(0, 0, i).Add(time.Hour),
+			Energy:    float64(1000 * (i + 1)),
+		}
+		if err := s.AddSession(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// sessions survive reopening
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = Open(file); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	cases := []struct {
+		filter core.SessionFilter
+		ids    []uint64
+	}{
+		{core.SessionFilter{}, []uint64{1, 2, 3}},
+		{core.SessionFilter{LoadPoint: "lp1"}, []uint64{1, 3}},
+		{core.SessionFilter{Vehicle: "Model 3"}, []uint64{}},
+		{core.SessionFilter{From: start.AddDate(0, 0, 1)}, []uint64{2, 3}},
+		{core.SessionFilter{To: start.AddDate(0, 0, 1)}, []uint64{1}},
+	}
+
+	for _, c := range cases {
+		res, err := s.Sessions(c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res) != len(c.ids) {
+			t.Errorf("%+v: expected %d sessions, got %d", c.filter, len(c.ids), len(res))
+			continue
+		}
+
+		for i, session := range res {
+			if session.ID != c.ids[i] {
+				t.Errorf("%+v: expected session %d, got %d", c.filter, c.ids[i], session.ID)
+			}
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "evcc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(filepath.Join(dir, "evcc.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if state, err := s.LoadState("lp1"); err != nil || state != nil {
+		t.Errorf("expected no state, got %v %v", state, err)
+	}
+
+	state := core.State{
+		Settings: core.Settings{Mode: "pv", MinCurrent: 6, MaxCurrent: 16, Phases: 3, TargetSoC: 80},
+		Session:  &core.SessionState{Start: time.Unix(1570000000, 0).UTC(), StartEnergy: 12345, Cost: 1.5},
+	}
+	if err := s.SaveState("lp1", state); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.LoadState("lp1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res == nil || res.Settings != state.Settings || res.Session == nil || *res.Session != *state.Session {
+		t.Errorf("unexpected state %+v", res)
+	}
+}